@@ -0,0 +1,302 @@
+package armory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// API versions used for Microsoft Defender for Cloud and Azure Monitor alerting requests
+const (
+	defenderSettingsAPIVersion = "2022-12-01-preview"
+	pricingsAPIVersion         = "2023-01-01"
+	securityAlertsAPIVersion   = "2022-01-01"
+	scheduledQueryAPIVersion   = "2023-03-15-preview"
+	alertsManagementAPIVersion = "2019-05-05-preview"
+)
+
+// AlertingPolicy holds the settings read from raids.ABS.alerting
+type AlertingPolicy struct {
+	TriggerBurst bool          // List containers and blobs repeatedly and wait for an alert
+	BurstSize    int           // Number of list requests sent
+	Timeout      time.Duration // How long to wait for an alert after the burst
+	PollInterval time.Duration
+}
+
+// LoadAlertingPolicy reads raids.ABS.alerting, defaulting to a burst of 100 requests and a 30 minute wait
+func LoadAlertingPolicy() AlertingPolicy {
+	policy := AlertingPolicy{
+		TriggerBurst: viper.GetBool("raids.ABS.alerting.trigger_burst"),
+		BurstSize:    100,
+		Timeout:      30 * time.Minute,
+		PollInterval: time.Minute,
+	}
+	if viper.IsSet("raids.ABS.alerting.burst_size") {
+		policy.BurstSize = viper.GetInt("raids.ABS.alerting.burst_size")
+	}
+	if viper.IsSet("raids.ABS.alerting.timeout_minutes") {
+		policy.Timeout = time.Duration(viper.GetFloat64("raids.ABS.alerting.timeout_minutes") * float64(time.Minute))
+	}
+	if viper.IsSet("raids.ABS.alerting.poll_interval_seconds") {
+		policy.PollInterval = time.Duration(viper.GetFloat64("raids.ABS.alerting.poll_interval_seconds") * float64(time.Second))
+	}
+	return policy
+}
+
+// DefenderStatus reports whether Microsoft Defender for Storage protects the account, either through its own
+// setting or through the subscription's Standard plan, and describes where the protection comes from.
+// An account setting that overrides the subscription decides on its own, so a disabled override is not protected.
+func (c *ARMClient) DefenderStatus(ctx context.Context, target *Target) (bool, string, error) {
+	var setting struct {
+		Properties struct {
+			IsEnabled                         bool `json:"isEnabled"`
+			OverrideSubscriptionLevelSettings bool `json:"overrideSubscriptionLevelSettings"`
+		} `json:"properties"`
+	}
+	err := c.Get(ctx, target.ResourceID()+"/providers/Microsoft.Security/defenderForStorageSettings/current", defenderSettingsAPIVersion, &setting)
+	var armErr *ARMError
+	switch {
+	case err == nil && setting.Properties.OverrideSubscriptionLevelSettings && !setting.Properties.IsEnabled:
+		return false, "Defender for Storage is disabled on the account, overriding the subscription plan", nil
+	case err == nil && setting.Properties.IsEnabled:
+		return true, "Defender for Storage is enabled on the account", nil
+	case err != nil && !(errors.As(err, &armErr) && armErr.StatusCode == http.StatusNotFound):
+		return false, "", fmt.Errorf("unable to read the account's Defender for Storage setting: %v", err)
+	}
+
+	var pricing struct {
+		Properties struct {
+			PricingTier string `json:"pricingTier"`
+			SubPlan     string `json:"subPlan"`
+		} `json:"properties"`
+	}
+	if err := c.Get(ctx, fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Security/pricings/StorageAccounts", target.SubscriptionID), pricingsAPIVersion, &pricing); err != nil {
+		return false, "", fmt.Errorf("unable to read the subscription's Defender plan: %v", err)
+	}
+	if strings.EqualFold(pricing.Properties.PricingTier, "Standard") {
+		return true, fmt.Sprintf("Defender for Storage %s plan is enabled on subscription %s", pricing.Properties.SubPlan, target.SubscriptionID), nil
+	}
+	return false, "Defender for Storage is not enabled on the account or its subscription", nil
+}
+
+// ScheduledQueryRule is a Microsoft.Insights/scheduledQueryRules resource
+type ScheduledQueryRule struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Properties struct {
+		Enabled  bool     `json:"enabled"`
+		Scopes   []string `json:"scopes"`
+		Criteria struct {
+			AllOf []struct {
+				Query string `json:"query"`
+			} `json:"allOf"`
+		} `json:"criteria"`
+	} `json:"properties"`
+}
+
+// FindEnumerationAlertRules returns the enabled scheduled-query alert rules that watch the account's blob logs for
+// list operations. A rule only sees those logs when it is scoped to one of workspaces, the Log Analytics workspaces
+// the account's diagnostic settings send StorageRead to, or to the account itself. Rules are read from the account's
+// subscription and from the subscription of each workspace.
+func (c *ARMClient) FindEnumerationAlertRules(ctx context.Context, target *Target, workspaces []string) ([]ScheduledQueryRule, error) {
+	subscriptions := []string{target.SubscriptionID}
+	for _, workspace := range workspaces {
+		if subscription := subscriptionOf(workspace); subscription != "" && !containsFold(subscriptions, subscription) {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	scopes := append([]string{target.ResourceID()}, workspaces...)
+
+	var rules []ScheduledQueryRule
+	for _, subscription := range subscriptions {
+		path := fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Insights/scheduledQueryRules", subscription)
+		err := c.List(ctx, path, scheduledQueryAPIVersion, func(item json.RawMessage) error {
+			var rule ScheduledQueryRule
+			if err := json.Unmarshal(item, &rule); err != nil {
+				return err
+			}
+			if !rule.Properties.Enabled || !rule.watches(scopes) {
+				return nil
+			}
+			for _, criterion := range rule.Properties.Criteria.AllOf {
+				query := strings.ToLower(criterion.Query)
+				if strings.Contains(query, "storagebloblogs") && (strings.Contains(query, "listblobs") || strings.Contains(query, "listcontainers")) {
+					rules = append(rules, rule)
+					return nil
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// watches reports whether any of the rule's scopes is one of scopes
+func (r *ScheduledQueryRule) watches(scopes []string) bool {
+	for _, scope := range r.Properties.Scopes {
+		if containsFold(scopes, strings.TrimSuffix(scope, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriptionOf returns the subscription ID from a resource ID
+func subscriptionOf(resourceID string) string {
+	parts := strings.Split(resourceID, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if strings.EqualFold(parts[i], "subscriptions") {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+// SecurityAlert is an alert raised about a storage account
+type SecurityAlert struct {
+	Source string // Defender for Cloud or Azure Monitor
+	Name   string
+	Raised time.Time
+}
+
+// AlertPoller returns the alerts raised about target since a point in time.
+// ARMAlertPoller is the production implementation; tests can substitute a fake on ABS.Alerts.
+type AlertPoller interface {
+	PollAlerts(ctx context.Context, target *Target, since time.Time) ([]SecurityAlert, error)
+}
+
+// ARMAlertPoller reads Defender for Cloud security alerts and fired Azure Monitor alerts through Resource Manager.
+// Alerts from scheduled-query rules target the Log Analytics workspace rather than the account, so alerts on the
+// account's StorageRead workspaces count when they come from one of the rules FindEnumerationAlertRules approves.
+type ARMAlertPoller struct {
+	ARM *ARMClient
+}
+
+// PollAlerts implements AlertPoller
+func (p *ARMAlertPoller) PollAlerts(ctx context.Context, target *Target, since time.Time) ([]SecurityAlert, error) {
+	var alerts []SecurityAlert
+	resourceID := strings.ToLower(target.ResourceID())
+
+	path := fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Security/alerts", target.SubscriptionID)
+	err := p.ARM.List(ctx, path, securityAlertsAPIVersion, func(item json.RawMessage) error {
+		var alert struct {
+			Properties struct {
+				AlertDisplayName    string    `json:"alertDisplayName"`
+				StartTimeUtc        time.Time `json:"startTimeUtc"`
+				ResourceIdentifiers []struct {
+					AzureResourceID string `json:"azureResourceId"`
+				} `json:"resourceIdentifiers"`
+			} `json:"properties"`
+		}
+		if err := json.Unmarshal(item, &alert); err != nil {
+			return err
+		}
+		if alert.Properties.StartTimeUtc.Before(since) {
+			return nil
+		}
+		for _, identifier := range alert.Properties.ResourceIdentifiers {
+			if strings.ToLower(identifier.AzureResourceID) == resourceID {
+				alerts = append(alerts, SecurityAlert{Source: "Defender for Cloud", Name: alert.Properties.AlertDisplayName, Raised: alert.Properties.StartTimeUtc})
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list security alerts: %v", err)
+	}
+
+	fired, err := p.firedAlerts(ctx, target.ResourceID(), since, nil)
+	if err != nil {
+		return nil, err
+	}
+	alerts = append(alerts, fired...)
+
+	workspaces, err := p.ARM.StorageReadWorkspaces(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if len(workspaces) == 0 {
+		return alerts, nil
+	}
+	rules, err := p.ARM.FindEnumerationAlertRules(ctx, target, workspaces)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list scheduled query alert rules: %v", err)
+	}
+	ruleIDs := []string{}
+	for _, rule := range rules {
+		ruleIDs = append(ruleIDs, rule.ID)
+	}
+	for _, workspace := range workspaces {
+		fired, err := p.firedAlerts(ctx, workspace, since, ruleIDs)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, fired...)
+	}
+	return alerts, nil
+}
+
+// firedAlerts returns the Azure Monitor alerts raised on resourceID since the given time. When rules is not nil,
+// only alerts fired by one of those alert rule IDs are returned.
+func (p *ARMAlertPoller) firedAlerts(ctx context.Context, resourceID string, since time.Time, rules []string) ([]SecurityAlert, error) {
+	var alerts []SecurityAlert
+	path := fmt.Sprintf("/subscriptions/%s/providers/Microsoft.AlertsManagement/alerts?targetResource=%s&timeRange=1d",
+		subscriptionOf(resourceID), url.QueryEscape(resourceID))
+	err := p.ARM.List(ctx, path, alertsManagementAPIVersion, func(item json.RawMessage) error {
+		var alert struct {
+			Name       string `json:"name"`
+			Properties struct {
+				Essentials struct {
+					AlertRule     string    `json:"alertRule"`
+					StartDateTime time.Time `json:"startDateTime"`
+				} `json:"essentials"`
+			} `json:"properties"`
+		}
+		if err := json.Unmarshal(item, &alert); err != nil {
+			return err
+		}
+		essentials := alert.Properties.Essentials
+		if essentials.StartDateTime.Before(since) || (rules != nil && !containsFold(rules, essentials.AlertRule)) {
+			return nil
+		}
+		alerts = append(alerts, SecurityAlert{Source: "Azure Monitor", Name: alert.Name, Raised: essentials.StartDateTime})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list alerts fired on %s: %v", resourceName(resourceID), err)
+	}
+	return alerts, nil
+}
+
+// WaitForAlert polls through poller until an alert about target raised since the given time appears or the timeout passes
+func WaitForAlert(ctx context.Context, poller AlertPoller, target *Target, since time.Time, policy AlertingPolicy) (*SecurityAlert, error) {
+	deadline := time.Now().Add(policy.Timeout)
+	for {
+		alerts, err := poller.PollAlerts(ctx, target, since)
+		if err != nil {
+			return nil, err
+		}
+		if len(alerts) > 0 {
+			return &alerts[0], nil
+		}
+		if time.Now().Add(policy.PollInterval).After(deadline) {
+			return nil, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(policy.PollInterval):
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package armory
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// fakeAlertPoller answers the nth poll with polls[n], repeating the last answer once they run out
+type fakeAlertPoller struct {
+	mutex sync.Mutex
+	polls [][]SecurityAlert
+	count int
+	since time.Time
+}
+
+func (f *fakeAlertPoller) PollAlerts(ctx context.Context, target *Target, since time.Time) ([]SecurityAlert, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.count++
+	f.since = since
+	if len(f.polls) == 0 {
+		return nil, nil
+	}
+	answer := f.polls[0]
+	if len(f.polls) > 1 {
+		f.polls = f.polls[1:]
+	}
+	return answer, nil
+}
+
+func TestWaitForAlert(t *testing.T) {
+	policy := AlertingPolicy{Timeout: time.Second, PollInterval: time.Millisecond}
+	since := time.Now()
+	poller := &fakeAlertPoller{polls: [][]SecurityAlert{nil, nil, {{Source: "Azure Monitor", Name: "enumeration", Raised: since.Add(time.Minute)}}}}
+
+	alert, err := WaitForAlert(context.Background(), poller, recordedTarget(), since, policy)
+	if err != nil || alert == nil || alert.Name != "enumeration" {
+		t.Errorf("got %+v, %v", alert, err)
+	}
+	if poller.count != 3 || !poller.since.Equal(since) {
+		t.Errorf("polled %d times since %s", poller.count, poller.since)
+	}
+
+	policy.Timeout = 10 * time.Millisecond
+	alert, err = WaitForAlert(context.Background(), &fakeAlertPoller{}, recordedTarget(), since, policy)
+	if err != nil || alert != nil {
+		t.Errorf("expected no alert once the timeout passes, got %+v, %v", alert, err)
+	}
+}
+
+func TestDefenderStatus(t *testing.T) {
+	target := recordedTarget()
+	setting := "GET " + target.ResourceID() + "/providers/Microsoft.Security/defenderForStorageSettings/current"
+	pricing := "GET /subscriptions/" + target.SubscriptionID + "/providers/Microsoft.Security/pricings/StorageAccounts"
+	standard := `{"properties":{"pricingTier":"Standard","subPlan":"DefenderForStorageV2"}}`
+
+	for name, test := range map[string]struct {
+		responses map[string]string
+		enabled   bool
+		detail    string
+		err       string
+	}{
+		"enabled on the account": {
+			responses: map[string]string{setting: `{"properties":{"isEnabled":true}}`},
+			enabled:   true,
+			detail:    "enabled on the account",
+		},
+		"disabled override": {
+			responses: map[string]string{setting: `{"properties":{"isEnabled":false,"overrideSubscriptionLevelSettings":true}}`, pricing: standard},
+			detail:    "disabled on the account, overriding the subscription plan",
+		},
+		"inherited from the subscription": {
+			responses: map[string]string{setting: `{"properties":{"isEnabled":false}}`, pricing: standard},
+			enabled:   true,
+			detail:    "DefenderForStorageV2 plan is enabled on subscription",
+		},
+		"no account setting": {
+			responses: map[string]string{pricing: standard},
+			enabled:   true,
+			detail:    "plan is enabled on subscription",
+		},
+		"subscription plan unreadable": {
+			responses: map[string]string{setting: `{"properties":{"isEnabled":false}}`},
+			err:       "unable to read the subscription's Defender plan",
+		},
+	} {
+		_, arm := newFakeARM(t, test.responses)
+		enabled, detail, err := arm.DefenderStatus(context.Background(), target)
+		switch {
+		case test.err != "":
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got %v", name, test.err, err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", name, err)
+		case enabled != test.enabled || !strings.Contains(detail, test.detail):
+			t.Errorf("%s: got %t %q", name, enabled, detail)
+		}
+	}
+}
+
+func TestFindEnumerationAlertRulesRequiresWorkspaceScope(t *testing.T) {
+	target := recordedTarget()
+	workspace := "/subscriptions/sub-logs/resourceGroups/rg-logs/providers/Microsoft.OperationalInsights/workspaces/central"
+	query := `{"query":"StorageBlobLogs | where OperationName in ('ListBlobs', 'ListContainers') | summarize count() by CallerIpAddress"}`
+	_, arm := newFakeARM(t, map[string]string{
+		"GET /subscriptions/" + target.SubscriptionID + "/providers/Microsoft.Insights/scheduledQueryRules": `{"value":[
+			{"name":"other-workspace","properties":{"enabled":true,"scopes":["/subscriptions/sub-x/resourceGroups/rg/providers/Microsoft.OperationalInsights/workspaces/elsewhere"],"criteria":{"allOf":[` + query + `]}}},
+			{"name":"on-account","properties":{"enabled":true,"scopes":["` + target.ResourceID() + `"],"criteria":{"allOf":[` + query + `]}}}
+		]}`,
+		"GET /subscriptions/sub-logs/providers/Microsoft.Insights/scheduledQueryRules": `{"value":[
+			{"name":"on-workspace","properties":{"enabled":true,"scopes":["` + strings.ToLower(workspace) + `"],"criteria":{"allOf":[` + query + `]}}},
+			{"name":"disabled","properties":{"enabled":false,"scopes":["` + workspace + `"],"criteria":{"allOf":[` + query + `]}}}
+		]}`,
+	})
+
+	rules, err := arm.FindEnumerationAlertRules(context.Background(), target, []string{workspace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+	if strings.Join(names, ",") != "on-account,on-workspace" {
+		t.Errorf("found %v, want only the enabled rules scoped to the account or its workspace", names)
+	}
+}
+
+func TestEnumerationBurstRaisesAlert(t *testing.T) {
+	var mutex sync.Mutex
+	requests := 0
+	blob, client := newFakeBlobService(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests++
+		mutex.Unlock()
+		w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Containers/><Blobs/><NextMarker/></EnumerationResults>`))
+	})
+	target := recordedTarget()
+	target.Endpoints.Blob = blob.URL
+	target.Container = "raid"
+	viper.Set("raids.ABS.alerting.burst_size", 4)
+	viper.Set("raids.ABS.alerting.timeout_minutes", 0.001)
+	viper.Set("raids.ABS.alerting.poll_interval_seconds", 0.001)
+	t.Cleanup(viper.Reset)
+
+	poller := &fakeAlertPoller{polls: [][]SecurityAlert{nil, {{Source: "Defender for Cloud", Name: "Unusual enumeration", Raised: time.Now().Add(3 * time.Minute)}}}}
+	abs := &ABS{Alerts: poller, Credential: staticCredential{}, HTTPClient: client.HTTPClient}
+	result := abs.CCC_C07_TR01_T02(target)
+	if !result.Passed || !strings.Contains(result.Message, `Defender for Cloud alert "Unusual enumeration" was raised 3m0s after 4 list requests`) {
+		t.Errorf("passed=%t %s", result.Passed, result.Message)
+	}
+	if requests != 4 {
+		t.Errorf("sent %d list requests, want 4", requests)
+	}
+
+	abs.Alerts = &fakeAlertPoller{}
+	result = abs.CCC_C07_TR01_T02(target)
+	if result.Passed || !strings.Contains(result.Message, "No alert was raised") {
+		t.Errorf("passed without an alert: %s", result.Message)
+	}
+}
+
+func TestARMAlertPollerFollowsWorkspaceAlerts(t *testing.T) {
+	target := recordedTarget()
+	workspace := "/subscriptions/sub-logs/resourceGroups/rg-logs/providers/Microsoft.OperationalInsights/workspaces/central"
+	rule := "/subscriptions/sub-logs/resourceGroups/rg-logs/providers/Microsoft.Insights/scheduledQueryRules/enumeration"
+	query := `{"query":"StorageBlobLogs | where OperationName == 'ListBlobs'"}`
+	since := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+	fake, arm := newFakeARM(t, map[string]string{
+		"GET /subscriptions/" + target.SubscriptionID + "/providers/Microsoft.Security/alerts": `{"value":[
+			{"properties":{"alertDisplayName":"Unusual enumeration","startTimeUtc":"2026-10-14T09:05:00Z","resourceIdentifiers":[{"azureResourceId":"` + strings.ToUpper(target.ResourceID()) + `"}]}},
+			{"properties":{"alertDisplayName":"Before the burst","startTimeUtc":"2026-10-14T08:00:00Z","resourceIdentifiers":[{"azureResourceId":"` + target.ResourceID() + `"}]}}
+		]}`,
+		"GET /subscriptions/" + target.SubscriptionID + "/providers/Microsoft.AlertsManagement/alerts": `{"value":[]}`,
+		"GET " + target.ResourceID() + "/blobServices/default/providers/Microsoft.Insights/diagnosticSettings": `{"value":[` +
+			`{"name":"audit","properties":{"workspaceId":"` + workspace + `","logs":[{"category":"StorageRead","enabled":true}]}}]}`,
+		"GET /subscriptions/" + target.SubscriptionID + "/providers/Microsoft.Insights/scheduledQueryRules": `{"value":[]}`,
+		"GET /subscriptions/sub-logs/providers/Microsoft.Insights/scheduledQueryRules": `{"value":[
+			{"id":"` + rule + `","name":"enumeration","properties":{"enabled":true,"scopes":["` + workspace + `"],"criteria":{"allOf":[` + query + `]}}}
+		]}`,
+		"GET /subscriptions/sub-logs/providers/Microsoft.AlertsManagement/alerts": `{"value":[
+			{"name":"enumeration fired","properties":{"essentials":{"alertRule":"` + strings.ToLower(rule) + `","startDateTime":"2026-10-14T09:10:00Z"}}},
+			{"name":"unrelated rule","properties":{"essentials":{"alertRule":"/subscriptions/sub-logs/resourceGroups/rg-logs/providers/Microsoft.Insights/scheduledQueryRules/disk","startDateTime":"2026-10-14T09:10:00Z"}}}
+		]}`,
+	})
+
+	alerts, err := (&ARMAlertPoller{ARM: arm}).PollAlerts(context.Background(), target, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, alert := range alerts {
+		found = append(found, alert.Source+": "+alert.Name)
+	}
+	if strings.Join(found, ", ") != "Defender for Cloud: Unusual enumeration, Azure Monitor: enumeration fired" {
+		t.Errorf("found %v", found)
+	}
+	for _, prefix := range []string{
+		"GET /subscriptions/" + target.SubscriptionID + "/providers/Microsoft.AlertsManagement/alerts?",
+		"GET /subscriptions/sub-logs/providers/Microsoft.AlertsManagement/alerts?",
+	} {
+		if !fake.requested(prefix) {
+			t.Errorf("%s was not requested", prefix)
+		}
+	}
+}
@@ -0,0 +1,454 @@
+package armory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/privateerproj/privateer-sdk/raidengine"
+)
+
+// API versions used for Azure Resource Manager requests
+const (
+	storageAPIVersion       = "2023-05-01"
+	keyVaultAPIVersion      = "2023-07-01"
+	resourcesAPIVersion     = "2021-04-01"
+	authorizationAPIVersion = "2022-04-01"
+	subscriptionsAPIVersion = "2022-12-01"
+)
+
+// ARMError is returned when Azure Resource Manager responds with a non-success status
+type ARMError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Details    []string // Codes of any nested error details, such as RequestDisallowedByPolicy
+}
+
+func (e *ARMError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("ARM request failed with HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("ARM request failed with HTTP %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// ARMClient makes authenticated requests to the Azure Resource Manager REST API
+type ARMClient struct {
+	Endpoint   string
+	Scope      string
+	Credential TokenCredential
+	HTTPClient *http.Client
+}
+
+// NewARMClient creates a client for the resource manager endpoint of cloud
+func NewARMClient(cloud CloudEnvironment, credential TokenCredential, client *http.Client) *ARMClient {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &ARMClient{
+		Endpoint:   strings.TrimSuffix(cloud.ResourceManagerEndpoint, "/"),
+		Scope:      cloud.ResourceManagerScope,
+		Credential: credential,
+		HTTPClient: client,
+	}
+}
+
+// Get reads the resource at path and decodes the JSON response into out
+func (c *ARMClient) Get(ctx context.Context, path, apiVersion string, out interface{}) error {
+	return c.Do(ctx, http.MethodGet, c.resourceURL(path, apiVersion), nil, out)
+}
+
+// List reads every page of the collection at path, calling each for every item
+func (c *ARMClient) List(ctx context.Context, path, apiVersion string, each func(item json.RawMessage) error) error {
+	next := c.resourceURL(path, apiVersion)
+	for next != "" {
+		var page struct {
+			Value    []json.RawMessage `json:"value"`
+			NextLink string            `json:"nextLink"`
+		}
+		if err := c.Do(ctx, http.MethodGet, next, nil, &page); err != nil {
+			return err
+		}
+		for _, item := range page.Value {
+			if err := each(item); err != nil {
+				return err
+			}
+		}
+		next = page.NextLink
+	}
+	return nil
+}
+
+// Do sends body as JSON to the absolute requestURL and decodes the response into out, if provided
+func (c *ARMClient) Do(ctx context.Context, method, requestURL string, body, out interface{}) error {
+	token, err := c.Credential.GetToken(ctx, c.Scope)
+	if err != nil {
+		return fmt.Errorf("unable to authenticate to Azure Resource Manager: %v", err)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, requestURL, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token.Token)
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		armErr := &ARMError{StatusCode: response.StatusCode}
+		var parsed struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+				Details []struct {
+					Code string `json:"code"`
+				} `json:"details"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &parsed) == nil {
+			armErr.Code = parsed.Error.Code
+			armErr.Message = parsed.Error.Message
+			for _, detail := range parsed.Error.Details {
+				armErr.Details = append(armErr.Details, detail.Code)
+			}
+		}
+		return armErr
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// resourceURL joins a resource path to the endpoint, keeping any query already present on path
+func (c *ARMClient) resourceURL(path, apiVersion string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return c.Endpoint + path + separator + "api-version=" + url.QueryEscape(apiVersion)
+}
+
+// -----
+// Storage account resources
+// -----
+
+// StorageAccount is the subset of the Microsoft.Storage/storageAccounts resource read by the raid
+type StorageAccount struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Location string            `json:"location"`
+	Kind     string            `json:"kind"`
+	Tags     map[string]string `json:"tags"`
+	Identity *ManagedIdentity  `json:"identity"`
+	Sku      struct {
+		Name string `json:"name"` // For example Standard_LRS, Standard_GRS or Standard_RAGZRS
+		Tier string `json:"tier"`
+	} `json:"sku"`
+	Properties struct {
+		PrimaryLocation             string                      `json:"primaryLocation"`
+		SecondaryLocation           string                      `json:"secondaryLocation"` // Set only for geo-redundant SKUs
+		StatusOfSecondary           string                      `json:"statusOfSecondary"`
+		FailoverInProgress          bool                        `json:"failoverInProgress"`
+		LastGeoFailoverTime         string                      `json:"lastGeoFailoverTime"`
+		MinimumTLSVersion           string                      `json:"minimumTlsVersion"`
+		Encryption                  AccountEncryption           `json:"encryption"`
+		PublicNetworkAccess         string                      `json:"publicNetworkAccess"` // Enabled, Disabled or absent, which behaves as Enabled
+		AllowCrossTenantReplication *bool                       `json:"allowCrossTenantReplication"`
+		AllowSharedKeyAccess        *bool                       `json:"allowSharedKeyAccess"` // Absent behaves as true
+		NetworkACLs                 NetworkRuleSet              `json:"networkAcls"`
+		PrivateEndpointConnections  []PrivateEndpointConnection `json:"privateEndpointConnections"`
+		PrimaryEndpoints            struct {
+			Blob  string `json:"blob"`
+			DFS   string `json:"dfs"`
+			Queue string `json:"queue"`
+			Table string `json:"table"`
+			File  string `json:"file"`
+			Web   string `json:"web"`
+		} `json:"primaryEndpoints"`
+		SecondaryEndpoints struct {
+			Blob string `json:"blob"` // Set only for read-access geo-redundant SKUs
+		} `json:"secondaryEndpoints"`
+	} `json:"properties"`
+}
+
+// AccountEncryption is the encryption block of a storage account
+type AccountEncryption struct {
+	KeySource                       string `json:"keySource"`
+	RequireInfrastructureEncryption *bool  `json:"requireInfrastructureEncryption"`
+	Services                        map[string]struct {
+		Enabled bool   `json:"enabled"`
+		KeyType string `json:"keyType"`
+	} `json:"services"`
+	KeyVaultProperties *struct {
+		KeyName                       string `json:"keyname"`
+		KeyVersion                    string `json:"keyversion"` // Empty when the account follows the latest key version automatically
+		KeyVaultURI                   string `json:"keyvaulturi"`
+		CurrentVersionedKeyIdentifier string `json:"currentVersionedKeyIdentifier"`
+		LastKeyRotationTimestamp      string `json:"lastKeyRotationTimestamp"`
+		CurrentVersionedKeyExpiration string `json:"currentVersionedKeyExpirationTimestamp"`
+	} `json:"keyvaultproperties"`
+	Identity *struct {
+		UserAssignedIdentity string `json:"userAssignedIdentity"`
+	} `json:"identity"`
+}
+
+// NetworkRuleSet is the networkAcls block of a storage account
+type NetworkRuleSet struct {
+	Bypass        string `json:"bypass"` // Comma separated: None, AzureServices, Logging, Metrics
+	DefaultAction string `json:"defaultAction"`
+	IPRules       []struct {
+		Value  string `json:"value"`
+		Action string `json:"action"`
+	} `json:"ipRules"`
+	VirtualNetworkRules []struct {
+		ID     string `json:"id"`
+		Action string `json:"action"`
+		State  string `json:"state"`
+	} `json:"virtualNetworkRules"`
+	ResourceAccessRules []struct {
+		TenantID   string `json:"tenantId"`
+		ResourceID string `json:"resourceId"`
+	} `json:"resourceAccessRules"`
+}
+
+// PrivateEndpointConnection links a private endpoint to a storage account
+type PrivateEndpointConnection struct {
+	ID         string `json:"id"`
+	Properties struct {
+		PrivateEndpoint struct {
+			ID string `json:"id"`
+		} `json:"privateEndpoint"`
+		PrivateLinkServiceConnectionState struct {
+			Status string `json:"status"` // Approved, Pending, Rejected or Disconnected
+		} `json:"privateLinkServiceConnectionState"`
+	} `json:"properties"`
+}
+
+// ManagedIdentity is the identity block of a resource
+type ManagedIdentity struct {
+	Type                   string `json:"type"`
+	PrincipalID            string `json:"principalId"`
+	TenantID               string `json:"tenantId"`
+	UserAssignedIdentities map[string]struct {
+		PrincipalID string `json:"principalId"`
+		ClientID    string `json:"clientId"`
+	} `json:"userAssignedIdentities"`
+}
+
+// EncryptionScope is a Microsoft.Storage/storageAccounts/encryptionScopes resource
+type EncryptionScope struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Properties struct {
+		Source                          string `json:"source"`
+		State                           string `json:"state"`
+		RequireInfrastructureEncryption bool   `json:"requireInfrastructureEncryption"`
+		KeyVaultProperties              struct {
+			KeyURI                        string `json:"keyUri"`
+			CurrentVersionedKeyIdentifier string `json:"currentVersionedKeyIdentifier"`
+			LastKeyRotationTimestamp      string `json:"lastKeyRotationTimestamp"`
+		} `json:"keyVaultProperties"`
+	} `json:"properties"`
+}
+
+// BlobContainer is a Microsoft.Storage/storageAccounts/blobServices/containers resource
+type BlobContainer struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Properties struct {
+		DefaultEncryptionScope      string `json:"defaultEncryptionScope"`
+		DenyEncryptionScopeOverride bool   `json:"denyEncryptionScopeOverride"`
+		PublicAccess                string `json:"publicAccess"`
+	} `json:"properties"`
+}
+
+// GetStorageAccount reads the storage account identified by target
+func (c *ARMClient) GetStorageAccount(ctx context.Context, target *Target) (*StorageAccount, error) {
+	account := &StorageAccount{}
+	if err := c.Get(ctx, target.ResourceID(), storageAPIVersion, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// ListStorageAccounts returns every storage account in the subscription, or in the resource group when one is given
+func (c *ARMClient) ListStorageAccounts(ctx context.Context, subscriptionID, resourceGroup string) ([]StorageAccount, error) {
+	path := fmt.Sprintf("/subscriptions/%s", subscriptionID)
+	if resourceGroup != "" {
+		path += fmt.Sprintf("/resourceGroups/%s", resourceGroup)
+	}
+	path += "/providers/Microsoft.Storage/storageAccounts"
+
+	var accounts []StorageAccount
+	err := c.List(ctx, path, storageAPIVersion, func(item json.RawMessage) error {
+		var account StorageAccount
+		if err := json.Unmarshal(item, &account); err != nil {
+			return err
+		}
+		accounts = append(accounts, account)
+		return nil
+	})
+	return accounts, err
+}
+
+// ListSubscriptions returns the ID of every subscription the credential can read
+func (c *ARMClient) ListSubscriptions(ctx context.Context) ([]string, error) {
+	var subscriptions []string
+	err := c.List(ctx, "/subscriptions", subscriptionsAPIVersion, func(item json.RawMessage) error {
+		var subscription struct {
+			SubscriptionID string `json:"subscriptionId"`
+		}
+		if err := json.Unmarshal(item, &subscription); err != nil {
+			return err
+		}
+		subscriptions = append(subscriptions, subscription.SubscriptionID)
+		return nil
+	})
+	return subscriptions, err
+}
+
+// otherSubscriptions returns every readable subscription except the one already searched
+func (c *ARMClient) otherSubscriptions(ctx context.Context, searched string) ([]string, error) {
+	subscriptions, err := c.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list subscriptions: %v", err)
+	}
+	var others []string
+	for _, subscription := range subscriptions {
+		if !strings.EqualFold(subscription, searched) {
+			others = append(others, subscription)
+		}
+	}
+	return others, nil
+}
+
+// ListEncryptionScopes returns every encryption scope defined on the storage account
+func (c *ARMClient) ListEncryptionScopes(ctx context.Context, target *Target) ([]EncryptionScope, error) {
+	var scopes []EncryptionScope
+	err := c.List(ctx, target.ResourceID()+"/encryptionScopes", storageAPIVersion, func(item json.RawMessage) error {
+		var scope EncryptionScope
+		if err := json.Unmarshal(item, &scope); err != nil {
+			return err
+		}
+		scopes = append(scopes, scope)
+		return nil
+	})
+	return scopes, err
+}
+
+// ListContainers returns every blob container in the storage account
+func (c *ARMClient) ListContainers(ctx context.Context, target *Target) ([]BlobContainer, error) {
+	var containers []BlobContainer
+	err := c.List(ctx, target.ResourceID()+"/blobServices/default/containers", storageAPIVersion, func(item json.RawMessage) error {
+		var container BlobContainer
+		if err := json.Unmarshal(item, &container); err != nil {
+			return err
+		}
+		containers = append(containers, container)
+		return nil
+	})
+	return containers, err
+}
+
+// UpdateTags merges tags into, or deletes them from, the tags of the resource without touching its other properties
+func (c *ARMClient) UpdateTags(ctx context.Context, resourceID, operation string, tags map[string]string) error {
+	body := map[string]interface{}{
+		"operation":  operation, // Merge, Replace or Delete
+		"properties": map[string]interface{}{"tags": tags},
+	}
+	requestURL := c.resourceURL(resourceID+"/providers/Microsoft.Resources/tags/default", resourcesAPIVersion)
+	return c.Do(ctx, http.MethodPatch, requestURL, body, nil)
+}
+
+// cleanupTags deletes tags a movement added to the resource, noting any failure in the movement message.
+// It uses its own deadline so that cleanup still runs after the movement's context has expired.
+func cleanupTags(client *ARMClient, resourceID string, tags map[string]string, result *raidengine.MovementResult) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := client.UpdateTags(ctx, resourceID, "Delete", tags); err != nil {
+		result.Message += fmt.Sprintf("; unable to remove the raid tag from %s: %v", resourceName(resourceID), err)
+	}
+}
+
+// -----
+// Authorization resources
+// -----
+
+// RoleAssignment is a Microsoft.Authorization/roleAssignments resource
+type RoleAssignment struct {
+	ID         string `json:"id"`
+	Properties struct {
+		Scope            string `json:"scope"`
+		RoleDefinitionID string `json:"roleDefinitionId"`
+		PrincipalID      string `json:"principalId"`
+		PrincipalType    string `json:"principalType"`
+	} `json:"properties"`
+}
+
+// ListRoleAssignments returns the role assignments at scope matching filter, such as atScope() or assignedTo('{id}')
+func (c *ARMClient) ListRoleAssignments(ctx context.Context, scope, filter string) ([]RoleAssignment, error) {
+	path := scope + "/providers/Microsoft.Authorization/roleAssignments?$filter=" + url.QueryEscape(filter)
+
+	var assignments []RoleAssignment
+	err := c.List(ctx, path, authorizationAPIVersion, func(item json.RawMessage) error {
+		var assignment RoleAssignment
+		if err := json.Unmarshal(item, &assignment); err != nil {
+			return err
+		}
+		assignments = append(assignments, assignment)
+		return nil
+	})
+	return assignments, err
+}
+
+// GetRoleName returns the display name of the role definition with the given resource ID
+func (c *ARMClient) GetRoleName(ctx context.Context, roleDefinitionID string) (string, error) {
+	var definition struct {
+		Properties struct {
+			RoleName string `json:"roleName"`
+		} `json:"properties"`
+	}
+	if err := c.Get(ctx, roleDefinitionID, authorizationAPIVersion, &definition); err != nil {
+		return "", err
+	}
+	return definition.Properties.RoleName, nil
+}
+
+// ResourceIDParts splits a storage account resource ID into its subscription, resource group and account name.
+// Resource IDs of any other type are rejected.
+func ResourceIDParts(resourceID string) (subscriptionID, resourceGroup, name string, err error) {
+	segments := strings.Split(strings.Trim(resourceID, "/"), "/")
+	if len(segments) != 8 || !strings.EqualFold(segments[0], "subscriptions") || !strings.EqualFold(segments[2], "resourceGroups") ||
+		!strings.EqualFold(segments[4], "providers") || !strings.EqualFold(segments[5], "Microsoft.Storage") ||
+		!strings.EqualFold(segments[6], "storageAccounts") || segments[1] == "" || segments[3] == "" || segments[7] == "" {
+		return "", "", "", fmt.Errorf("%q is not a storage account resource ID", resourceID)
+	}
+	return segments[1], segments[3], segments[7], nil
+}
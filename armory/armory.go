@@ -1,6 +1,19 @@
 package armory
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
 	hclog "github.com/hashicorp/go-hclog"
 	"github.com/spf13/viper"
 
@@ -13,6 +26,18 @@ type ABS struct {
 	Tactics map[string][]raidengine.Strike     // Required, allows you to sort which strikes are run for each control
 	Log     hclog.Logger                       // Recommended, allows you to set the log level for each log message
 	Results map[string]raidengine.StrikeResult // Optional, allows cross referencing between strikes
+
+	HTTPClient   *http.Client    // Shared HTTP client, built from raids.ABS.http on first use unless already set
+	HTTPConfig   HTTPConfig      // Network settings behind HTTPClient, also used to dial handshake probes
+	Credential   TokenCredential // Shared Azure credential, built from raids.ABS.auth on first use unless already set
+	ARM          *ARMClient      // Shared Azure Resource Manager client, built on first use unless already set
+	Graph        *GraphClient    // Shared Microsoft Graph client, built on first use unless already set
+	LogAnalytics LogQuerier      // Shared Log Analytics query backend, built on first use unless already set
+	Alerts       AlertPoller     // Shared alert polling backend, built on first use unless already set
+	Targets      []*Target       // Storage accounts under test, resolved from raids.ABS on first use unless already set
+
+	setupOnce sync.Once
+	setupErr  error
 }
 
 // Optionally, retrieve config variables using Viper.
@@ -31,6 +56,80 @@ func (a *ABS) GetTactics() map[string][]raidengine.Strike {
 	return a.Tactics
 }
 
+// setup reads the raid configuration once so that every strike shares the same clients
+func (a *ABS) setup() error {
+	a.setupOnce.Do(func() {
+		selection, err := LoadTargetSelection()
+		if err != nil {
+			a.setupErr = err
+			return
+		}
+		a.HTTPConfig = LoadHTTPConfig()
+		if a.HTTPClient == nil {
+			a.HTTPClient, a.setupErr = NewHTTPClient(a.HTTPConfig)
+			if a.setupErr != nil {
+				return
+			}
+		}
+		if a.Credential == nil {
+			config := LoadCredentialConfig()
+			if config.AuthorityHost == "" {
+				config.AuthorityHost = selection.Cloud.AuthorityHost
+			}
+			a.Credential, a.setupErr = NewCredential(config, a.HTTPClient)
+			if a.setupErr != nil {
+				return
+			}
+		}
+		if a.ARM == nil {
+			a.ARM = NewARMClient(selection.Cloud, a.Credential, a.HTTPClient)
+		}
+		if a.Graph == nil {
+			a.Graph = NewGraphClient(selection.Cloud, a.Credential, a.HTTPClient)
+		}
+		if a.LogAnalytics == nil {
+			a.LogAnalytics = NewLogAnalyticsClient(selection.Cloud, a.Credential, a.HTTPClient)
+		}
+		if a.Alerts == nil {
+			a.Alerts = &ARMAlertPoller{ARM: a.ARM}
+		}
+		if a.Targets == nil {
+			a.Targets, a.setupErr = selection.Resolve(context.Background(), a.ARM)
+		}
+	})
+	return a.setupErr
+}
+
+// ready runs setup and records any configuration error on the strike result
+func (a *ABS) ready(result *raidengine.StrikeResult) bool {
+	if err := a.setup(); err != nil {
+		result.Message = fmt.Sprintf("Raid configuration is invalid: %v", err)
+		return false
+	}
+	return true
+}
+
+// executeForTargets runs movement once per storage account, keying each movement result by account name.
+// The strike only passes if the movement passed for every account.
+func (a *ABS) executeForTargets(result *raidengine.StrikeResult, movementName string, movement func(target *Target) raidengine.MovementResult) {
+	for _, target := range a.Targets {
+		target := target
+		// the SDK runs and records the movement under its function name, which is the same for every account,
+		// so it records into a scratch result and the movement is re-keyed by account below
+		scratch := raidengine.StrikeResult{Movements: make(map[string]raidengine.MovementResult)}
+		raidengine.ExecuteMovement(&scratch, func() raidengine.MovementResult { return movement(target) })
+		var movementResult raidengine.MovementResult
+		for _, recorded := range scratch.Movements {
+			movementResult = recorded
+		}
+		if len(result.Movements) == 0 || result.Passed {
+			result.Passed = movementResult.Passed
+			result.Message = fmt.Sprintf("%s: %s", target.AccountName, movementResult.Message)
+		}
+		result.Movements[fmt.Sprintf("%s/%s", target.AccountName, movementName)] = movementResult
+	}
+}
+
 // -----
 // Strike and Movements for CCC_C01_TR01
 // -----
@@ -48,27 +147,27 @@ func (a *ABS) CCC_C01_TR01() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C01_TR01_T01) // Ensure GET requests communicate via TLS 1.2 or higher
-	// TODO: Consider adding other HTTP methods in subsequent movements
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C01_TR01_T01", a.CCC_C01_TR01_T01) // Ensure GET requests communicate via TLS 1.2 or higher
+	a.executeForTargets(&result, "CCC_C01_TR01_T02", a.CCC_C01_TR01_T02) // Ensure no weak cipher suites are accepted at TLS 1.2 or 1.3
+	a.executeForTargets(&result, "CCC_C01_TR01_T03", a.CCC_C01_TR01_T03) // Ensure each endpoint presents a valid certificate chain
+	a.executeForTargets(&result, "CCC_C01_TR01_T04", a.CCC_C01_TR01_T04) // Ensure every HTTP method is served over TLS 1.2 or higher
+	a.executeForTargets(&result, "CCC_C01_TR01_T05", a.CCC_C01_TR01_T05) // Ensure every HTTP method is rejected over plain HTTP
 
 	return
 }
 
 // CCC_C01_TR01_T01 - Ensure GET requests communicate via TLS 1.2 or higher
-func CCC_C01_TR01_T01() (result raidengine.MovementResult) {
+func (a *ABS) CCC_C01_TR01_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
 		Description: "Movement has not yet started",
 		Function:    utils.CallerPath(0),
 	}
-	result.Message = "Verifying that endpoint was provided"
-	endpoint := viper.GetString("raids.ABS.endpoint")
-	if endpoint == "" {
-		result.Message = "Endpoint not provided"
-		result.Passed = false
-		return
-	}
 
-	response := MakeGETRequest(endpoint, &result)
+	response := MakeGETRequest(a.HTTPClient, target.Endpoints.Blob, &result)
 	if !result.Passed {
 		return
 	}
@@ -79,6 +178,147 @@ func CCC_C01_TR01_T01() (result raidengine.MovementResult) {
 	return
 }
 
+// CCC_C01_TR01_T02 - Enumerate the cipher suites accepted at TLS 1.2 and 1.3 and flag weak ones
+func (a *ABS) CCC_C01_TR01_T02(target *Target) (result raidengine.MovementResult) {
+	result = raidengine.MovementResult{
+		Description: fmt.Sprintf("Enumerating cipher suites accepted by %s", target.Endpoints.Blob),
+		Function:    utils.CallerPath(0),
+	}
+
+	suites, err := EnumerateCipherSuites(a.HTTPConfig.DialContext, target.Endpoints.Blob)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to enumerate cipher suites: %v", err)
+		return
+	}
+	if len(suites) == 0 {
+		result.Message = "No TLS 1.2 or TLS 1.3 cipher suite was accepted"
+		return
+	}
+
+	var strong, weak []string
+	for _, suite := range suites {
+		if len(suite.Weaknesses) == 0 {
+			strong = append(strong, fmt.Sprintf("%s %s", TLSVersionName(suite.Version), suite.Name))
+			continue
+		}
+		weak = append(weak, fmt.Sprintf("%s %s (%s)", TLSVersionName(suite.Version), suite.Name, strings.Join(suite.Weaknesses, ", ")))
+	}
+	if len(weak) > 0 {
+		result.Message = fmt.Sprintf("Weak cipher suites accepted: %s", strings.Join(weak, "; "))
+		return
+	}
+	result.Passed = true
+	result.Message = fmt.Sprintf("Only strong cipher suites accepted: %s", strings.Join(strong, ", "))
+	return
+}
+
+// CCC_C01_TR01_T03 - Validate the certificate chain presented by each storage service endpoint
+func (a *ABS) CCC_C01_TR01_T03(target *Target) (result raidengine.MovementResult) {
+	result = raidengine.MovementResult{
+		Description: "Validating certificate chains, expiry, key strength and hostname coverage of each storage endpoint",
+		Function:    utils.CallerPath(0),
+	}
+	policy := LoadCertificatePolicy()
+	tlsConfig, err := a.HTTPConfig.TLSConfig()
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to load trusted roots: %v", err)
+		return
+	}
+	policy.Roots = tlsConfig.RootCAs
+
+	var evidence []string
+	result.Passed = true
+	for _, endpoint := range target.Endpoints.ByService() {
+		if endpoint.URL == "" {
+			continue
+		}
+		state, err := FetchTLSState(a.HTTPConfig.DialContext, endpoint.URL)
+		if err != nil {
+			result.Passed = false
+			evidence = append(evidence, fmt.Sprintf("%s: %v", endpoint.Service, err))
+			continue
+		}
+		report := InspectCertificates(endpoint.URL, state, policy)
+		summary := fmt.Sprintf("%s: leaf expires %s, OCSP stapled %t, SHA-256 fingerprints [%s]",
+			endpoint.Service, report.LeafExpiry.Format(time.RFC3339), report.OCSPStapled, strings.Join(report.Fingerprints, ", "))
+		if len(report.Issues) > 0 {
+			result.Passed = false
+			summary += fmt.Sprintf(", issues: %s", strings.Join(report.Issues, "; "))
+		}
+		evidence = append(evidence, summary)
+	}
+	result.Message = strings.Join(evidence, " | ")
+	return
+}
+
+// CCC_C01_TR01_T04 - Ensure PUT, HEAD, DELETE, OPTIONS and list requests communicate via TLS 1.2 or higher
+func (a *ABS) CCC_C01_TR01_T04(target *Target) (result raidengine.MovementResult) {
+	result = raidengine.MovementResult{
+		Description: "Sending each HTTP method over HTTPS and checking the negotiated TLS version",
+		Function:    utils.CallerPath(0),
+	}
+
+	var outcomes []string
+	result.Passed = true
+	for _, probe := range transportProbes(probeContainer(target)) {
+		response, errorCode, err := SendRequestProbe(a.HTTPClient, target.Endpoints.Blob, probe)
+		switch {
+		case err != nil:
+			result.Passed = false
+			outcomes = append(outcomes, fmt.Sprintf("%s failed: %v", probe.Name, err))
+		case response.TLS == nil:
+			result.Passed = false
+			outcomes = append(outcomes, fmt.Sprintf("%s was not served over TLS", probe.Name))
+		case response.TLS.Version < tls.VersionTLS12:
+			result.Passed = false
+			outcomes = append(outcomes, fmt.Sprintf("%s used %s", probe.Name, TLSVersionName(response.TLS.Version)))
+		case errorCode == "AccountRequiresHttps":
+			result.Passed = false
+			outcomes = append(outcomes, fmt.Sprintf("%s was rejected as insecure despite using HTTPS", probe.Name))
+		default:
+			outcomes = append(outcomes, fmt.Sprintf("%s used %s (HTTP %d)", probe.Name, TLSVersionName(response.TLS.Version), response.StatusCode))
+		}
+	}
+	result.Message = strings.Join(outcomes, "; ")
+	return
+}
+
+// CCC_C01_TR01_T05 - Ensure PUT, HEAD, DELETE, OPTIONS and list requests over plain HTTP are rejected with AccountRequiresHttps
+func (a *ABS) CCC_C01_TR01_T05(target *Target) (result raidengine.MovementResult) {
+	result = raidengine.MovementResult{
+		Description: "Sending each HTTP method over plain HTTP and checking that secure transfer is required",
+		Function:    utils.CallerPath(0),
+	}
+	httpEndpoint := strings.Replace(target.Endpoints.Blob, "https://", "http://", 1)
+
+	var outcomes []string
+	result.Passed = true
+	for _, probe := range transportProbes(probeContainer(target)) {
+		response, errorCode, err := SendRequestProbe(a.HTTPClient, httpEndpoint, probe)
+		switch {
+		case err != nil:
+			// without a response there is no evidence that the service enforces secure transfer
+			result.Passed = false
+			outcomes = append(outcomes, fmt.Sprintf("%s could not be sent: %v", probe.Name, err))
+		case errorCode == "AccountRequiresHttps":
+			outcomes = append(outcomes, fmt.Sprintf("%s rejected with AccountRequiresHttps (HTTP %d)", probe.Name, response.StatusCode))
+		default:
+			result.Passed = false
+			outcomes = append(outcomes, fmt.Sprintf("%s was not rejected with AccountRequiresHttps (HTTP %d, error code %q)", probe.Name, response.StatusCode, errorCode))
+		}
+	}
+	result.Message = strings.Join(outcomes, "; ")
+	return
+}
+
+// probeContainer returns the configured container, or a name that cannot exist, for non-destructive requests
+func probeContainer(target *Target) string {
+	if target.Container != "" {
+		return target.Container
+	}
+	return "privateer-raid-nonexistent"
+}
+
 // -----
 // Strike and Movements for CCC_C01_TR02
 // -----
@@ -96,20 +336,28 @@ func (a *ABS) CCC_C01_TR02() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C01_TR02_T01)
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C01_TR02_T01", a.CCC_C01_TR02_T01)
 	// TODO: Additional movement calls go here
 
 	return
 }
 
-func CCC_C01_TR02_T01() (result raidengine.MovementResult) {
+func (a *ABS) CCC_C01_TR02_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
 		Description: "The movement has not yet started.",
 		Function:    utils.CallerPath(0),
 	}
 
 	result.Description = "Verifying that HTTP endpoint is redirected to HTTPS"
-	ConfirmHTTPSRedirect(viper.GetString("raids.ABS.endpoint"), &result)
+	acceptRejection := true
+	if viper.IsSet("raids.ABS.transport.accept_https_rejection") {
+		acceptRejection = viper.GetBool("raids.ABS.transport.accept_https_rejection")
+	}
+	ConfirmHTTPSRedirect(a.HTTPClient, target.Endpoints.Blob, acceptRejection, &result)
 
 	return
 }
@@ -131,19 +379,77 @@ func (a *ABS) CCC_C01_TR03() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C01_TR03_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C01_TR03_T01", a.CCC_C01_TR03_T01)
+	a.executeForTargets(&result, "CCC_C01_TR03_T02", a.CCC_C01_TR03_T02)
 
 	return
 }
 
-func CCC_C01_TR03_T01() (result raidengine.MovementResult) {
+// CCC_C01_TR03_T01 - Attempt SSL 3.0, TLS 1.0 and TLS 1.1 handshakes against every storage service endpoint
+func (a *ABS) CCC_C01_TR03_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Attempting legacy protocol handshakes against each storage service endpoint",
+		Function:    utils.CallerPath(0),
+	}
+
+	var attempts, skipped []string
+	result.Passed = true
+	for _, endpoint := range target.Endpoints.ByService() {
+		if endpoint.URL == "" {
+			skipped = append(skipped, endpoint.Service)
+			continue
+		}
+		// a refusal only means something if the endpoint completes a modern handshake from this runner
+		baseline := ProbeProtocol(a.HTTPConfig.DialContext, endpoint.URL, tls.VersionTLS12)
+		if !baseline.Accepted {
+			result.Passed = false
+			attempts = append(attempts, fmt.Sprintf("%s: baseline %s, legacy versions not probed", endpoint.Service, baseline))
+			continue
+		}
+		for _, version := range []uint16{versionSSL30, tls.VersionTLS10, tls.VersionTLS11} {
+			probe := ProbeProtocol(a.HTTPConfig.DialContext, endpoint.URL, version)
+			if !probe.Refused() {
+				result.Passed = false
+			}
+			attempts = append(attempts, fmt.Sprintf("%s: %s", endpoint.Service, probe))
+		}
+	}
+
+	result.Message = strings.Join(attempts, "; ")
+	if len(skipped) > 0 {
+		result.Message += fmt.Sprintf("; endpoint unknown, not probed: %s", strings.Join(skipped, ", "))
+	}
+	return
+}
+
+// CCC_C01_TR03_T02 - Confirm the account's configured minimum TLS version excludes legacy protocols
+func (a *ABS) CCC_C01_TR03_T02(target *Target) (result raidengine.MovementResult) {
+	result = raidengine.MovementResult{
+		Description: "Reading the storage account's minimumTlsVersion from Azure Resource Manager",
 		Function:    utils.CallerPath(0),
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C01_TR03
+	account, err := a.ARM.GetStorageAccount(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read storage account: %v", err)
+		return
+	}
+	switch account.Properties.MinimumTLSVersion {
+	case "TLS1_2", "TLS1_3":
+		result.Passed = true
+		result.Message = fmt.Sprintf("minimumTlsVersion is %s", account.Properties.MinimumTLSVersion)
+	case "":
+		// ARM omits the property on accounts that have never set it, which then default to TLS 1.0
+		result.Message = "minimumTlsVersion is not set, so the account accepts TLS 1.0"
+	default:
+		result.Message = fmt.Sprintf("minimumTlsVersion is %s, which permits legacy protocols", account.Properties.MinimumTLSVersion)
+	}
 	return
 }
 
@@ -164,19 +470,116 @@ func (a *ABS) CCC_C02_TR01() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C02_TR01_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C02_TR01_T01", a.CCC_C02_TR01_T01)
+	a.executeForTargets(&result, "CCC_C02_TR01_T02", a.CCC_C02_TR01_T02)
 
 	return
 }
 
-func CCC_C02_TR01_T01() (result raidengine.MovementResult) {
+// CCC_C02_TR01_T01 - Confirm blob and file encryption is enabled with a recognised key source
+func (a *ABS) CCC_C02_TR01_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Reading the storage account's encryption settings from Azure Resource Manager",
+		Function:    utils.CallerPath(0),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	account, err := a.ARM.GetStorageAccount(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read storage account: %v", err)
+		return
+	}
+	encryption := account.Properties.Encryption
+
+	var checks, failures []string
+	for _, service := range []string{"blob", "file"} {
+		settings, ok := encryption.Services[service]
+		switch {
+		case !ok:
+			failures = append(failures, fmt.Sprintf("%s service encryption is not reported", service))
+		case !settings.Enabled:
+			failures = append(failures, fmt.Sprintf("%s service encryption is disabled", service))
+		default:
+			checks = append(checks, fmt.Sprintf("%s service encryption enabled", service))
+		}
+	}
+
+	switch encryption.KeySource {
+	case "Microsoft.Storage", "Microsoft.Keyvault":
+		checks = append(checks, fmt.Sprintf("key source %s", encryption.KeySource))
+	default:
+		failures = append(failures, fmt.Sprintf("unrecognised key source %q", encryption.KeySource))
+	}
+
+	infrastructure := encryption.RequireInfrastructureEncryption != nil && *encryption.RequireInfrastructureEncryption
+	if viper.IsSet("raids.ABS.encryption.require_infrastructure_encryption") {
+		if required := viper.GetBool("raids.ABS.encryption.require_infrastructure_encryption"); infrastructure != required {
+			failures = append(failures, fmt.Sprintf("requireInfrastructureEncryption is %t but policy requires %t", infrastructure, required))
+		} else {
+			checks = append(checks, fmt.Sprintf("requireInfrastructureEncryption %t matches policy", infrastructure))
+		}
+	} else {
+		checks = append(checks, fmt.Sprintf("requireInfrastructureEncryption %t", infrastructure))
+	}
+
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, checks...), "; ")
+	return
+}
+
+// CCC_C02_TR01_T02 - Confirm every encryption scope used as a container default is enabled
+func (a *ABS) CCC_C02_TR01_T02(target *Target) (result raidengine.MovementResult) {
+	result = raidengine.MovementResult{
+		Description: "Checking the encryption scopes assigned to blob containers",
 		Function:    utils.CallerPath(0),
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	scopes, err := a.ARM.ListEncryptionScopes(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list encryption scopes: %v", err)
+		return
+	}
+	containers, err := a.ARM.ListContainers(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list containers: %v", err)
+		return
+	}
+
+	states := make(map[string]string)
+	for _, scope := range scopes {
+		states[strings.ToLower(scope.Name)] = scope.Properties.State
+	}
+
+	var checks, failures []string
+	for _, container := range containers {
+		scope := container.Properties.DefaultEncryptionScope
+		if scope == "" || scope == "$account-encryption-key" {
+			checks = append(checks, fmt.Sprintf("container %s uses the account encryption key", container.Name))
+			continue
+		}
+		state, ok := states[strings.ToLower(scope)]
+		switch {
+		case !ok:
+			failures = append(failures, fmt.Sprintf("container %s uses unknown scope %s", container.Name, scope))
+		case state != "Enabled":
+			failures = append(failures, fmt.Sprintf("container %s uses scope %s which is %s", container.Name, scope, state))
+		default:
+			checks = append(checks, fmt.Sprintf("container %s uses enabled scope %s", container.Name, scope))
+		}
+	}
+	if len(containers) == 0 {
+		checks = append(checks, "no containers to check")
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C02_TR01
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, checks...), "; ")
 	return
 }
 
@@ -197,19 +600,87 @@ func (a *ABS) CCC_C02_TR02() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C02_TR02_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C02_TR02_T01", a.CCC_C02_TR02_T01)
 
 	return
 }
 
-func CCC_C02_TR02_T01() (result raidengine.MovementResult) {
+// CCC_C02_TR02_T01 - Audit the vault, key and permissions behind every customer-managed key the account uses
+func (a *ABS) CCC_C02_TR02_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Resolving the account's customer-managed keys and checking their vaults, rotation and access",
 		Function:    utils.CallerPath(0),
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	account, err := a.ARM.GetStorageAccount(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read storage account: %v", err)
+		return
+	}
+	scopes, err := a.ARM.ListEncryptionScopes(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list encryption scopes: %v", err)
+		return
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C02_TR02
+	keys := make(map[string]string)     // consumer to key URI
+	usages := make(map[string]KeyUsage) // consumer to the key version it reports using
+	if keyURI := accountKeyURI(account); keyURI != "" {
+		keys["account "+account.Name] = keyURI
+		usages["account "+account.Name] = accountKeyUsage(account)
+	}
+	for _, scope := range scopes {
+		if strings.EqualFold(scope.Properties.Source, "Microsoft.KeyVault") && scope.Properties.State == "Enabled" {
+			properties := scope.Properties.KeyVaultProperties
+			keys["encryption scope "+scope.Name] = properties.KeyURI
+			usages["encryption scope "+scope.Name] = keyUsage(properties.CurrentVersionedKeyIdentifier, properties.LastKeyRotationTimestamp)
+		}
+	}
+
+	if len(keys) == 0 {
+		result.Passed = !viper.GetBool("raids.ABS.encryption.require_customer_managed_keys")
+		result.Message = "account and encryption scopes use Microsoft-managed keys"
+		if !result.Passed {
+			result.Message += ", but policy requires customer-managed keys"
+		}
+		return
+	}
+
+	principalID, err := wrappingPrincipal(account)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to determine the identity used to wrap keys: %v", err)
+		return
+	}
+	audit := &KeyAudit{ARM: a.ARM, SubscriptionID: target.SubscriptionID, PrincipalID: principalID}
+
+	consumers := make([]string, 0, len(keys))
+	for consumer := range keys {
+		consumers = append(consumers, consumer)
+	}
+	sort.Strings(consumers)
+
+	var evidence, failures []string
+	for _, consumer := range consumers {
+		reference, err := ParseKeyURI(keys[consumer])
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", consumer, err))
+			continue
+		}
+		record := audit.Audit(ctx, consumer, reference, usages[consumer])
+		evidence = append(evidence, record.String())
+		for _, issue := range record.Issues {
+			failures = append(failures, fmt.Sprintf("%s: %s", consumer, issue))
+		}
+	}
+
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, evidence...), "; ")
 	return
 }
 
@@ -230,19 +701,43 @@ func (a *ABS) CCC_C03_TR01() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C03_TR01_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	// Conditional Access is evaluated once for the tenant rather than per storage account
+	raidengine.ExecuteMovement(&result, a.CCC_C03_TR01_T01)
 
 	return
 }
 
-func CCC_C03_TR01_T01() (result raidengine.MovementResult) {
+// CCC_C03_TR01_T01 - Confirm Conditional Access requires MFA for every user signing in to Azure Resource Manager and Azure Storage
+func (a *ABS) CCC_C03_TR01_T01() (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Evaluating Conditional Access policies from Microsoft Graph for all users",
 		Function:    utils.CallerPath(0),
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	policies, err := a.Graph.ListConditionalAccessPolicies(ctx)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list Conditional Access policies: %v", err)
+		return
+	}
+	mfa := LoadMFAPolicy()
+
+	var checks, failures []string
+	for _, app := range []struct{ name, id string }{
+		{"Azure Resource Manager", AzureResourceManagerAppID},
+		{"Azure Storage", AzureStorageAppID},
+	} {
+		coverage := EvaluateMFACoverage(policies, app.id, "", mfa.AllowedExclusions)
+		checks, failures = reportMFACoverage(checks, failures, "all users of "+app.name, coverage)
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C03_TR01
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, checks...), "; ")
 	return
 }
 
@@ -263,22 +758,70 @@ func (a *ABS) CCC_C03_TR02() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C03_TR02_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	// Conditional Access is evaluated once for the tenant rather than per storage account
+	raidengine.ExecuteMovement(&result, a.CCC_C03_TR02_T01)
 
 	return
 }
 
-func CCC_C03_TR02_T01() (result raidengine.MovementResult) {
+// CCC_C03_TR02_T01 - Confirm Conditional Access requires MFA for privileged roles signing in to Azure Resource Manager and Azure Storage
+func (a *ABS) CCC_C03_TR02_T01() (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Evaluating Conditional Access policies from Microsoft Graph for privileged directory roles",
 		Function:    utils.CallerPath(0),
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	policies, err := a.Graph.ListConditionalAccessPolicies(ctx)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list Conditional Access policies: %v", err)
+		return
+	}
+	mfa := LoadMFAPolicy()
+
+	roles := make([]string, 0, len(mfa.PrivilegedRoles))
+	for role := range mfa.PrivilegedRoles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return mfa.PrivilegedRoles[roles[i]] < mfa.PrivilegedRoles[roles[j]] })
+
+	var checks, failures []string
+	for _, app := range []struct{ name, id string }{
+		{"Azure Resource Manager", AzureResourceManagerAppID},
+		{"Azure Storage", AzureStorageAppID},
+	} {
+		for _, role := range roles {
+			coverage := EvaluateMFACoverage(policies, app.id, role, mfa.AllowedExclusions)
+			checks, failures = reportMFACoverage(checks, failures, mfa.PrivilegedRoles[role]+" on "+app.name, coverage)
+		}
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C03_TR02
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, checks...), "; ")
 	return
 }
 
+// reportMFACoverage appends a description of coverage for population to checks or failures
+func reportMFACoverage(checks, failures []string, population string, coverage MFACoverage) ([]string, []string) {
+	switch {
+	case len(coverage.Policies) == 0 && len(coverage.Partial) > 0:
+		failures = append(failures, fmt.Sprintf("%s: MFA is only required conditionally by %s", population, strings.Join(coverage.Partial, ", ")))
+	case len(coverage.Policies) == 0:
+		failures = append(failures, fmt.Sprintf("%s: no enabled policy requires MFA", population))
+	case len(coverage.FallThrough) > 0:
+		failures = append(failures, fmt.Sprintf("%s: %s excluded from %s", population,
+			strings.Join(coverage.FallThrough, ", "), strings.Join(coverage.Policies, ", ")))
+	default:
+		checks = append(checks, fmt.Sprintf("%s covered by %s", population, strings.Join(coverage.Policies, ", ")))
+	}
+	return checks, failures
+}
+
 // -----
 // Strike and Movements for CCC_C04_TR01
 // -----
@@ -296,19 +839,90 @@ func (a *ABS) CCC_C04_TR01() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C04_TR01_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C04_TR01_T01", a.CCC_C04_TR01_T01)
+	if LoadLoggingPolicy().VerifyDelivery {
+		a.executeForTargets(&result, "CCC_C04_TR01_T02", a.CCC_C04_TR01_T02)
+	}
 
 	return
 }
 
-func CCC_C04_TR01_T01() (result raidengine.MovementResult) {
+// CCC_C04_TR01_T01 - Confirm blob read, write and delete logs are shipped to at least one destination
+func (a *ABS) CCC_C04_TR01_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Reading the diagnostic settings of the blob service",
+		Function:    utils.CallerPath(0),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	settings, err := a.ARM.ListDiagnosticSettings(ctx, target.ResourceID()+"/blobServices/default")
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list diagnostic settings: %v", err)
+		return
+	}
+
+	var checks, failures []string
+	for _, category := range blobLogCategories {
+		var destinations []string
+		for _, setting := range settings {
+			if setting.Enables(category) {
+				destinations = append(destinations, setting.Destinations()...)
+			}
+		}
+		if len(destinations) == 0 {
+			failures = append(failures, fmt.Sprintf("%s is not shipped to any destination", category))
+			continue
+		}
+		checks = append(checks, fmt.Sprintf("%s shipped to %s", category, strings.Join(destinations, ", ")))
+	}
+
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, checks...), "; ")
+	return
+}
+
+// CCC_C04_TR01_T02 - Read a blob and wait for the request to appear in the Log Analytics workspace
+func (a *ABS) CCC_C04_TR01_T02(target *Target) (result raidengine.MovementResult) {
+	result = raidengine.MovementResult{
+		Description: "Reading a blob and confirming the request is recorded in StorageBlobLogs",
 		Function:    utils.CallerPath(0),
 	}
+	policy := LoadLoggingPolicy()
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout+2*time.Minute)
+	defer cancel()
+
+	workspace, workspaceID, err := a.blobLogWorkspace(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to locate the StorageRead workspace: %v", err)
+		return
+	}
+	if workspace == "" {
+		result.Message = "StorageRead is not shipped to a Log Analytics workspace, so delivery cannot be verified"
+		return
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C04_TR01
+	// the blob, and without a configured container the container too, does not exist, but the failed read is logged just the same
+	name := testBlobName("CCC_C04_TR01_T02")
+	sent := time.Now()
+	_, _ = a.blobClient(target).GetBlob(ctx, probeContainer(target), name, "")
+
+	query := fmt.Sprintf("StorageBlobLogs | where OperationName == 'GetBlob' and Uri contains '%s' | project TimeGenerated, CallerIpAddress, StatusText", name)
+	rows, err := WaitForLogs(ctx, a.LogAnalytics, workspaceID, query, policy)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to query workspace %s: %v", resourceName(workspace), err)
+		return
+	}
+	if len(rows) == 0 {
+		result.Message = fmt.Sprintf("Read of %s did not appear in workspace %s within %s", name, resourceName(workspace), policy.Timeout)
+		return
+	}
+	result.Passed = true
+	result.Message = fmt.Sprintf("Read of %s appeared in workspace %s after %s", name, resourceName(workspace), time.Since(sent).Round(time.Second))
 	return
 }
 
@@ -329,19 +943,107 @@ func (a *ABS) CCC_C04_TR02() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C04_TR02_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C04_TR02_T01", a.CCC_C04_TR02_T01)
+	if LoadLoggingPolicy().VerifyChanges {
+		a.executeForTargets(&result, "CCC_C04_TR02_T02", a.CCC_C04_TR02_T02)
+	}
 
 	return
 }
 
-func CCC_C04_TR02_T01() (result raidengine.MovementResult) {
+// CCC_C04_TR02_T01 - Confirm the subscription's Activity Log exports administrative and policy events
+func (a *ABS) CCC_C04_TR02_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Reading the Activity Log diagnostic settings of the account's subscription",
 		Function:    utils.CallerPath(0),
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	settings, err := a.ARM.ListDiagnosticSettings(ctx, "/subscriptions/"+target.SubscriptionID)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list Activity Log diagnostic settings: %v", err)
+		return
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C04_TR02
+	var checks, failures []string
+	for _, category := range activityLogCategories {
+		var destinations []string
+		for _, setting := range settings {
+			if setting.Enables(category) {
+				destinations = append(destinations, setting.Destinations()...)
+			}
+		}
+		if len(destinations) == 0 {
+			failures = append(failures, fmt.Sprintf("%s events are not exported from subscription %s", category, target.SubscriptionID))
+			continue
+		}
+		checks = append(checks, fmt.Sprintf("%s events exported to %s", category, strings.Join(destinations, ", ")))
+	}
+
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, checks...), "; ")
+	return
+}
+
+// CCC_C04_TR02_T02 - Add and remove a tag on the account and wait for the change to appear in the exported Activity Log
+func (a *ABS) CCC_C04_TR02_T02(target *Target) (result raidengine.MovementResult) {
+	result = raidengine.MovementResult{
+		Description: "Updating a tag on the storage account and confirming the write is recorded in AzureActivity",
+		Function:    utils.CallerPath(0),
+	}
+	policy := LoadLoggingPolicy()
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout+2*time.Minute)
+	defer cancel()
+
+	settings, err := a.ARM.ListDiagnosticSettings(ctx, "/subscriptions/"+target.SubscriptionID)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list Activity Log diagnostic settings: %v", err)
+		return
+	}
+	workspace := ""
+	for _, setting := range settings {
+		if setting.Properties.WorkspaceID != "" && setting.Enables("Administrative") {
+			workspace = setting.Properties.WorkspaceID
+			break
+		}
+	}
+	if workspace == "" {
+		result.Message = "Administrative events are not exported to a Log Analytics workspace, so capture cannot be verified"
+		return
+	}
+	workspaceID, err := a.ARM.GetWorkspaceCustomerID(ctx, workspace)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read workspace %s: %v", resourceName(workspace), err)
+		return
+	}
+
+	tags := map[string]string{"privateer-raid": time.Now().UTC().Format(time.RFC3339)}
+	sent := time.Now()
+	if err := a.ARM.UpdateTags(ctx, target.ResourceID(), "Merge", tags); err != nil {
+		result.Message = fmt.Sprintf("Unable to tag the storage account: %v", err)
+		return
+	}
+	defer cleanupTags(a.ARM, target.ResourceID(), tags, &result)
+
+	query := fmt.Sprintf("AzureActivity | where OperationNameValue =~ 'Microsoft.Resources/tags/write' and _ResourceId =~ '%s'"+
+		" and TimeGenerated >= datetime(%s) | project TimeGenerated, Caller, ActivityStatusValue",
+		target.ResourceID(), sent.Add(-time.Minute).UTC().Format(time.RFC3339))
+	rows, err := WaitForLogs(ctx, a.LogAnalytics, workspaceID, query, policy)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to query workspace %s: %v", resourceName(workspace), err)
+		return
+	}
+	if len(rows) == 0 {
+		result.Message = fmt.Sprintf("Tag update did not appear in workspace %s within %s", resourceName(workspace), policy.Timeout)
+		return
+	}
+	result.Passed = true
+	result.Message = fmt.Sprintf("Tag update by %v appeared in workspace %s after %s", rows[0]["Caller"], resourceName(workspace), time.Since(sent).Round(time.Second))
 	return
 }
 
@@ -362,19 +1064,67 @@ func (a *ABS) CCC_C05_TR01() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C05_TR01_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C05_TR01_T01", a.CCC_C05_TR01_T01)
+	a.executeForTargets(&result, "CCC_C05_TR01_T02", a.CCC_C05_TR01_T02)
 
 	return
 }
 
-func CCC_C05_TR01_T01() (result raidengine.MovementResult) {
+// CCC_C05_TR01_T01 - Compare every network path into the account with the approved allowlist
+func (a *ABS) CCC_C05_TR01_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Reading the account's network rules and private endpoints and comparing them with raids.ABS.network.allowlist",
 		Function:    utils.CallerPath(0),
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C05_TR01
+	allowlist, err := LoadNetworkAllowlist()
+	if err != nil {
+		result.Message = err.Error()
+		return
+	}
+	account, err := a.ARM.GetStorageAccount(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read storage account: %v", err)
+		return
+	}
+
+	approved, unapproved := allowlist.Review(account)
+	for i, path := range unapproved {
+		unapproved[i] = "not in allowlist: " + path
+	}
+	result.Passed = len(unapproved) == 0
+	result.Message = strings.Join(append(unapproved, approved...), "; ")
+	return
+}
+
+// CCC_C05_TR01_T02 - Confirm the data plane refuses the raid runner, which is not on the allowlist
+func (a *ABS) CCC_C05_TR01_T02(target *Target) (result raidengine.MovementResult) {
+	result = raidengine.MovementResult{
+		Description: "Listing containers from the raid runner, expecting the network rules to refuse it",
+		Function:    utils.CallerPath(0),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := a.blobClient(target).ListContainers(ctx)
+	var storageErr *StorageError
+	switch {
+	case err == nil:
+		result.Message = "Container listing succeeded, so the runner's network location is allowed; run the raid from outside the allowlist"
+	case errors.As(err, &storageErr) && storageErr.Code == "AuthorizationFailure":
+		result.Passed = true
+		result.Message = "Request from the runner was refused with AuthorizationFailure"
+	case errors.As(err, &storageErr):
+		result.Message = fmt.Sprintf("Request reached the account and failed with %s rather than AuthorizationFailure, so the network rules did not refuse it", storageErr.Code)
+	default:
+		result.Message = fmt.Sprintf("Unable to reach the blob endpoint: %v", err)
+	}
 	return
 }
 
@@ -395,19 +1145,70 @@ func (a *ABS) CCC_C05_TR02() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C05_TR02_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C05_TR02_T01", a.CCC_C05_TR02_T01)
 
 	return
 }
 
-func CCC_C05_TR02_T01() (result raidengine.MovementResult) {
+// CCC_C05_TR02_T01 - Send a request with a forged SAS and confirm the failure is logged with the caller's address
+func (a *ABS) CCC_C05_TR02_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Reading a blob with an invalid SAS and searching StorageBlobLogs for the refused request",
 		Function:    utils.CallerPath(0),
 	}
+	policy := LoadLoggingPolicy()
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout+2*time.Minute)
+	defer cancel()
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C05_TR02
+	workspace, workspaceID, err := a.blobLogWorkspace(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to locate the StorageRead workspace: %v", err)
+		return
+	}
+	if workspace == "" {
+		result.Message = "StorageRead is not shipped to a Log Analytics workspace, so the attempt cannot be traced"
+		return
+	}
+
+	// the container need not exist, the request is refused before it is resolved
+	container := target.Container
+	if container == "" {
+		container = "privateer-raid"
+	}
+	name := testBlobName("CCC_C05_TR02_T01")
+	status, err := a.blobClient(target).GetWithForgedSAS(ctx, container, name)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to send the untrusted request: %v", err)
+		return
+	}
+	if status < 400 {
+		result.Message = fmt.Sprintf("Request with an invalid SAS was accepted with HTTP %d", status)
+		return
+	}
+
+	query := fmt.Sprintf("StorageBlobLogs | where Uri contains '%s' | project TimeGenerated, CallerIpAddress, StatusCode, StatusText", name)
+	rows, err := WaitForLogs(ctx, a.LogAnalytics, workspaceID, query, policy)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to query workspace %s: %v", resourceName(workspace), err)
+		return
+	}
+	if len(rows) == 0 {
+		result.Message = fmt.Sprintf("Refused request for %s (HTTP %d) did not appear in workspace %s within %s", name, status, resourceName(workspace), policy.Timeout)
+		return
+	}
+	entry := rows[0]
+	caller, _ := entry["CallerIpAddress"].(string)
+	statusText, _ := entry["StatusText"].(string)
+	if caller == "" || statusText == "" || strings.EqualFold(statusText, "Success") {
+		result.Message = fmt.Sprintf("Log entry for %s does not record the caller address and failure status (caller %q, status %q)", name, caller, statusText)
+		return
+	}
+	result.Passed = true
+	result.Message = fmt.Sprintf("Refused request for %s was logged from %s with status %v %s", name, caller, entry["StatusCode"], statusText)
 	return
 }
 
@@ -428,19 +1229,83 @@ func (a *ABS) CCC_C05_TR04() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C05_TR04_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C05_TR04_T01", a.CCC_C05_TR04_T01)
 
 	return
 }
 
-func CCC_C05_TR04_T01() (result raidengine.MovementResult) {
+// CCC_C05_TR04_T01 - Find every setting, rule, delegation and role assignment that lets another tenant reach the account
+func (a *ABS) CCC_C05_TR04_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Comparing tenant references on the storage account with raids.ABS.tenancy.trusted_tenants",
 		Function:    utils.CallerPath(0),
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	account, err := a.ARM.GetStorageAccount(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read storage account: %v", err)
+		return
+	}
+	homeTenant, err := a.ARM.GetSubscriptionTenant(ctx, target.SubscriptionID)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read the subscription's tenant: %v", err)
+		return
+	}
+	review := &TenantReview{HomeTenant: homeTenant, Trusted: LoadTrustedTenants()}
+
+	var failures []string
+	properties := account.Properties
+	// storage API versions from 2023-01-01 omit allowCrossTenantReplication while it holds the service default of false
+	if properties.AllowCrossTenantReplication != nil && *properties.AllowCrossTenantReplication {
+		failures = append(failures, "allowCrossTenantReplication is not disabled, so object replication to other tenants is possible")
+	}
+	if properties.AllowSharedKeyAccess == nil || *properties.AllowSharedKeyAccess {
+		failures = append(failures, "shared key access is enabled, so anyone holding an account key can connect from any tenant")
+	}
+	for _, rule := range properties.NetworkACLs.ResourceAccessRules {
+		review.Check(rule.TenantID, "resource access rule for "+rule.ResourceID)
+	}
+
+	assignments, err := a.ARM.ListRoleAssignments(ctx, target.ResourceID(), "atScope()")
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list role assignments: %v", err)
+		return
+	}
+	if err := review.ReviewPrincipals(ctx, a.Graph, assignments); err != nil {
+		result.Message = fmt.Sprintf("Unable to resolve role assignment principals: %v", err)
+		return
+	}
+
+	delegations, err := a.ARM.ListDelegatedTenants(ctx, target.SubscriptionID, target.ResourceGroup)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list Azure Lighthouse delegations: %v", err)
+		return
+	}
+	for _, delegation := range delegations {
+		name := delegation.TenantName
+		if name == "" {
+			name = "another tenant"
+		}
+		review.Check(delegation.TenantID, fmt.Sprintf("Azure Lighthouse offer %q delegates access to %s", delegation.Offer, name))
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C05_TR04
+	failures = append(failures, review.Foreign...)
+	var orphaned string
+	if len(review.Orphaned) > 0 {
+		orphaned = fmt.Sprintf("; orphaned role assignments: %s", strings.Join(review.Orphaned, ", "))
+	}
+	if len(failures) == 0 {
+		result.Passed = true
+		result.Message = fmt.Sprintf("No references to tenants other than %s or the trusted tenants were found%s", homeTenant, orphaned)
+		return
+	}
+	result.Message = strings.Join(failures, "; ") + orphaned
 	return
 }
 
@@ -461,19 +1326,109 @@ func (a *ABS) CCC_C06_TR01() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C06_TR01_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C06_TR01_T01", a.CCC_C06_TR01_T01)
+	if LoadRegionPolicy().VerifyDeniedDeployment {
+		a.executeForTargets(&result, "CCC_C06_TR01_T02", a.CCC_C06_TR01_T02)
+	}
 
 	return
 }
 
-func CCC_C06_TR01_T01() (result raidengine.MovementResult) {
+// CCC_C06_TR01_T01 - Confirm the account's regions are permitted and an Allowed locations policy covers it
+func (a *ABS) CCC_C06_TR01_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Comparing the account's primary and secondary regions and Allowed locations assignments with raids.ABS.regions",
 		Function:    utils.CallerPath(0),
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C06_TR01
+	account, err := a.ARM.GetStorageAccount(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read storage account: %v", err)
+		return
+	}
+	regions := LoadRegionPolicy()
+
+	var checks, failures []string
+	for _, location := range []struct{ role, region string }{
+		{"primary", account.Location},
+		{"secondary", account.Properties.SecondaryLocation},
+	} {
+		switch {
+		case location.region == "":
+			continue
+		case regions.Permits(location.region):
+			checks = append(checks, fmt.Sprintf("%s region %s is permitted", location.role, location.region))
+		default:
+			failures = append(failures, fmt.Sprintf("%s region %s is restricted", location.role, location.region))
+		}
+	}
+
+	assignments, err := a.ARM.FindAllowedLocations(ctx, account.ID)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read policy assignments: %v", err)
+		return
+	}
+	if len(assignments) == 0 {
+		failures = append(failures, "no enforced Allowed locations policy assignment covers the account")
+	}
+	for _, assignment := range assignments {
+		if len(assignment.Locations) == 0 {
+			failures = append(failures, fmt.Sprintf("Allowed locations assignment %s at %s lists no locations that could be resolved", assignment.Name, assignment.Scope))
+			continue
+		}
+		var restricted []string
+		for _, location := range assignment.Locations {
+			if !regions.Permits(location) {
+				restricted = append(restricted, location)
+			}
+		}
+		if len(restricted) > 0 {
+			failures = append(failures, fmt.Sprintf("Allowed locations assignment %s permits restricted regions %s", assignment.Name, strings.Join(restricted, ", ")))
+			continue
+		}
+		checks = append(checks, fmt.Sprintf("Allowed locations assignment %s at %s permits %s", assignment.Name, assignment.Scope, strings.Join(assignment.Locations, ", ")))
+	}
+
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, checks...), "; ")
+	return
+}
+
+// CCC_C06_TR01_T02 - Validate a deployment to a denied region and confirm Azure Policy refuses it
+func (a *ABS) CCC_C06_TR01_T02(target *Target) (result raidengine.MovementResult) {
+	result = raidengine.MovementResult{
+		Description: "Validating, without deploying, a storage account in a denied region",
+		Function:    utils.CallerPath(0),
+	}
+	regions := LoadRegionPolicy()
+	if len(regions.Denied) == 0 {
+		result.Message = "raids.ABS.regions.denied must list a region to validate a deployment against"
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	suffix := make([]byte, 7)
+	_, _ = rand.Read(suffix)
+	name := "privateer" + hex.EncodeToString(suffix)
+	region := regions.Denied[0]
+
+	err := a.ARM.ValidateStorageDeployment(ctx, target.SubscriptionID, target.ResourceGroup, name, region)
+	switch {
+	case err == nil:
+		result.Message = fmt.Sprintf("Deployment of a storage account to %s passed validation", region)
+	case disallowedByPolicy(err):
+		result.Passed = true
+		result.Message = fmt.Sprintf("Deployment of a storage account to %s was refused by policy", region)
+	default:
+		result.Message = fmt.Sprintf("Deployment validation for %s failed for a reason other than policy: %v", region, err)
+	}
 	return
 }
 
@@ -494,19 +1449,58 @@ func (a *ABS) CCC_C06_TR02() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C06_TR02_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C06_TR02_T01", a.CCC_C06_TR02_T01)
 
 	return
 }
 
-func CCC_C06_TR02_T01() (result raidengine.MovementResult) {
+// CCC_C06_TR02_T01 - Confirm every secondary, replica and backup copy of the account's data is in a permitted region
+func (a *ABS) CCC_C06_TR02_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Enumerating the account's secondary region, object replication destinations and backup vaults",
 		Function:    utils.CallerPath(0),
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	account, err := a.ARM.GetStorageAccount(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read storage account: %v", err)
+		return
+	}
+	locations, err := a.ARM.DataLocations(ctx, target, account)
+	if err != nil {
+		result.Message = fmt.Sprintf("Inconclusive, not every copy of the data could be located: %v", err)
+		return
+	}
+	regions := LoadRegionPolicy()
+
+	var checks, failures []string
+	if account.Properties.FailoverInProgress {
+		checks = append(checks, fmt.Sprintf("failover to %s is in progress", account.Properties.SecondaryLocation))
+	} else if account.Properties.LastGeoFailoverTime != "" {
+		checks = append(checks, fmt.Sprintf("last failed over at %s", account.Properties.LastGeoFailoverTime))
+	}
+	for _, location := range locations {
+		switch {
+		case location.Region == "":
+			failures = append(failures, fmt.Sprintf("%s could not be verified: %s", location, location.Unresolved))
+		case !regions.Permits(location.Region):
+			failures = append(failures, fmt.Sprintf("%s is a restricted region", location))
+		default:
+			checks = append(checks, location.String())
+		}
+	}
+	if len(locations) == 0 {
+		checks = append(checks, fmt.Sprintf("data is held only in %s", account.Location))
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C06_TR02
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, checks...), "; ")
 	return
 }
 
@@ -527,19 +1521,95 @@ func (a *ABS) CCC_C07_TR01() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C07_TR01_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C07_TR01_T01", a.CCC_C07_TR01_T01)
+	if LoadAlertingPolicy().TriggerBurst {
+		a.executeForTargets(&result, "CCC_C07_TR01_T02", a.CCC_C07_TR01_T02)
+	}
 
 	return
 }
 
-func CCC_C07_TR01_T01() (result raidengine.MovementResult) {
+// CCC_C07_TR01_T01 - Confirm Defender for Storage or a scheduled-query alert rule watches for enumeration
+func (a *ABS) CCC_C07_TR01_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Checking for Defender for Storage or an alert rule on list operations in StorageBlobLogs",
+		Function:    utils.CallerPath(0),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	enabled, detail, err := a.ARM.DefenderStatus(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to determine Defender for Storage status: %v", err)
+		return
+	}
+	workspaces, err := a.ARM.StorageReadWorkspaces(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to locate the StorageRead workspaces: %v", err)
+		return
+	}
+	rules, err := a.ARM.FindEnumerationAlertRules(ctx, target, workspaces)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list scheduled query alert rules: %v", err)
+		return
+	}
+
+	checks := []string{detail}
+	if len(rules) > 0 {
+		var names []string
+		for _, rule := range rules {
+			names = append(names, rule.Name)
+		}
+		checks = append(checks, fmt.Sprintf("enumeration alert rules %s are enabled", strings.Join(names, ", ")))
+	} else {
+		checks = append(checks, "no enabled scheduled query rule scoped to the account or its log workspace watches StorageBlobLogs for list operations")
+	}
+	result.Passed = enabled || len(rules) > 0
+	result.Message = strings.Join(checks, "; ")
+	return
+}
+
+// CCC_C07_TR01_T02 - Enumerate the account repeatedly and measure how long it takes for an alert to be raised
+func (a *ABS) CCC_C07_TR01_T02(target *Target) (result raidengine.MovementResult) {
+	result = raidengine.MovementResult{
+		Description: "Sending a burst of container and blob list requests and waiting for an alert",
 		Function:    utils.CallerPath(0),
 	}
+	policy := LoadAlertingPolicy()
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout+5*time.Minute)
+	defer cancel()
+	client := a.blobClient(target)
+
+	start := time.Now()
+	for i := 0; i < policy.BurstSize; i++ {
+		var err error
+		if target.Container != "" && i%2 == 1 {
+			_, err = client.ListBlobVersions(ctx, target.Container, "")
+		} else {
+			_, err = client.ListContainers(ctx)
+		}
+		if err != nil {
+			result.Message = fmt.Sprintf("List request %d of %d failed: %v", i+1, policy.BurstSize, err)
+			return
+		}
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C07_TR01
+	alert, err := WaitForAlert(ctx, a.Alerts, target, start, policy)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to poll for alerts: %v", err)
+		return
+	}
+	if alert == nil {
+		result.Message = fmt.Sprintf("No alert was raised within %s of %d list requests", policy.Timeout, policy.BurstSize)
+		return
+	}
+	result.Passed = true
+	result.Message = fmt.Sprintf("%s alert %q was raised %s after %d list requests began", alert.Source, alert.Name,
+		alert.Raised.Sub(start).Round(time.Second), policy.BurstSize)
 	return
 }
 
@@ -560,19 +1630,89 @@ func (a *ABS) CCC_C07_TR02() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C07_TR02_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C07_TR02_T01", a.CCC_C07_TR02_T01)
 
 	return
 }
 
-func CCC_C07_TR02_T01() (result raidengine.MovementResult) {
+// CCC_C07_TR02_T01 - Enumerate the account with a traceable client request ID and read the entries back from StorageBlobLogs
+func (a *ABS) CCC_C07_TR02_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Listing containers and blobs with a tagged client request ID and reading the operations back from StorageBlobLogs",
 		Function:    utils.CallerPath(0),
 	}
+	policy := LoadLoggingPolicy()
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout+2*time.Minute)
+	defer cancel()
+
+	workspace, workspaceID, err := a.blobLogWorkspace(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to locate the StorageRead workspace: %v", err)
+		return
+	}
+	if workspace == "" {
+		result.Message = "StorageRead is not shipped to a Log Analytics workspace, so the enumeration cannot be traced"
+		return
+	}
+
+	suffix := make([]byte, 6)
+	_, _ = rand.Read(suffix)
+	client := a.blobClient(target)
+	client.ClientRequestID = "privateer-raid-ccc_c07_tr02_t01-" + hex.EncodeToString(suffix)
+
+	operations := []string{"ListContainers"}
+	if _, err := client.ListContainers(ctx); err != nil {
+		result.Message = fmt.Sprintf("Unable to list containers: %v", err)
+		return
+	}
+	if target.Container != "" {
+		operations = append(operations, "ListBlobs")
+		if _, err := client.ListBlobVersions(ctx, target.Container, ""); err != nil {
+			result.Message = fmt.Sprintf("Unable to list blobs in %s: %v", target.Container, err)
+			return
+		}
+	}
+
+	query := fmt.Sprintf("StorageBlobLogs | where ClientRequestId == '%s' | project TimeGenerated, OperationName, CallerIpAddress, AuthenticationType, RequesterObjectId, RequesterUpn",
+		client.ClientRequestID)
+	rows, err := WaitForOperations(ctx, a.LogAnalytics, workspaceID, query, policy, operations)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to query workspace %s as the auditing principal: %v", resourceName(workspace), err)
+		return
+	}
+	if len(rows) == 0 {
+		result.Message = fmt.Sprintf("Requests tagged %s did not appear in workspace %s within %s", client.ClientRequestID, resourceName(workspace), policy.Timeout)
+		return
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C07_TR02
+	var checks, failures []string
+	for _, operation := range operations {
+		entry := operationRow(rows, operation)
+		if entry == nil {
+			failures = append(failures, fmt.Sprintf("%s tagged %s was not logged within %s", operation, client.ClientRequestID, policy.Timeout))
+			continue
+		}
+		caller, _ := entry["CallerIpAddress"].(string)
+		identity, _ := entry["RequesterUpn"].(string)
+		if identity == "" {
+			identity, _ = entry["RequesterObjectId"].(string)
+		}
+		// shared key requests carry no principal, the key itself is the identity
+		if authentication, _ := entry["AuthenticationType"].(string); identity == "" && strings.EqualFold(authentication, "AccountKey") {
+			identity = "account key"
+		}
+		if caller == "" || identity == "" {
+			failures = append(failures, fmt.Sprintf("%s entry does not record the caller (address %q, identity %q)", operation, caller, identity))
+			continue
+		}
+		checks = append(checks, fmt.Sprintf("%s by %s from %s is readable in workspace %s", operation, identity, caller, resourceName(workspace)))
+	}
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, checks...), "; ")
 	return
 }
 
@@ -593,19 +1733,64 @@ func (a *ABS) CCC_C08_TR01() (strikeName string, result raidengine.StrikeResult)
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_C08_TR01_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_C08_TR01_T01", a.CCC_C08_TR01_T01)
 
 	return
 }
 
-func CCC_C08_TR01_T01() (result raidengine.MovementResult) {
+// CCC_C08_TR01_T01 - Classify the account's redundancy from its SKU and compare it with the configured minimum
+func (a *ABS) CCC_C08_TR01_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Reading the account SKU and checking that its redundancy meets the configured minimum",
 		Function:    utils.CallerPath(0),
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	minimum, err := LoadMinimumRedundancy()
+	if err != nil {
+		result.Message = err.Error()
+		return
+	}
+	account, err := a.ARM.GetStorageAccount(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read storage account: %v", err)
+		return
+	}
+	redundancy, ok := ParseRedundancy(account.Sku.Name)
+	if !ok {
+		result.Message = fmt.Sprintf("SKU %s has an unrecognized redundancy option", account.Sku.Name)
+		return
+	}
+
+	primary := account.Properties.PrimaryLocation
+	if primary == "" {
+		primary = account.Location
+	}
+	checks := []string{fmt.Sprintf("SKU %s is %s with primary region %s", account.Sku.Name, redundancy.Name, primary)}
+	if redundancy.GeoRedundant {
+		secondary := fmt.Sprintf("secondary region %s is %s", account.Properties.SecondaryLocation, account.Properties.StatusOfSecondary)
+		if redundancy.ReadableSecondary {
+			secondary += " and readable"
+		} else {
+			secondary += " and not readable"
+		}
+		checks = append(checks, secondary)
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_C08_TR01
+	var failures []string
+	switch {
+	case redundancy.Name == "LRS":
+		failures = append(failures, "LRS keeps every copy in a single datacenter")
+	case minimum != nil && !redundancy.Meets(*minimum):
+		failures = append(failures, fmt.Sprintf("%s does not meet the required minimum of %s", redundancy.Name, minimum.Name))
+	}
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, checks...), "; ")
 	return
 }
 
@@ -626,19 +1811,114 @@ func (a *ABS) CCC_ObjStor_C08_TR02() (strikeName string, result raidengine.Strik
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_ObjStor_C08_TR02_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_ObjStor_C08_TR02_T01", a.CCC_ObjStor_C08_TR02_T01)
 
 	return
 }
 
-func CCC_ObjStor_C08_TR02_T01() (result raidengine.MovementResult) {
+// CCC_ObjStor_C08_TR02_T01 - Read replication status from ARM, the secondary endpoint and object replication policies
+func (a *ABS) CCC_ObjStor_C08_TR02_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Reading geo-replication statistics and the status of each object replication rule and comparing the sync lag with the RPO",
 		Function:    utils.CallerPath(0),
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	account, err := a.ARM.GetStorageAccount(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read storage account: %v", err)
+		return
+	}
+	policies, err := a.ARM.ListObjectReplicationPolicies(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list object replication policies: %v", err)
+		return
+	}
+	redundancy, _ := ParseRedundancy(account.Sku.Name)
+	if !redundancy.GeoRedundant && len(policies) == 0 {
+		result.Message = fmt.Sprintf("SKU %s has no secondary region and no object replication policy, so there is no replication status to report", account.Sku.Name)
+		return
+	}
+
+	rpo := LoadRecoveryPointObjective()
+	now := time.Now()
+	var checks, failures []string
+	review := func(source string, stats *GeoReplicationStats) {
+		lag, synced := stats.Lag(now)
+		switch {
+		case !synced:
+			failures = append(failures, fmt.Sprintf("%s reports status %s and no completed sync", source, stats.Status))
+		case lag > rpo:
+			failures = append(failures, fmt.Sprintf("%s reports status %s and a last sync %s ago, beyond the %s RPO", source, stats.Status, lag.Round(time.Second), rpo))
+		default:
+			checks = append(checks, fmt.Sprintf("%s reports status %s and a last sync %s ago", source, stats.Status, lag.Round(time.Second)))
+		}
+	}
+
+	if redundancy.GeoRedundant {
+		stats, err := a.ARM.GetGeoReplicationStats(ctx, target)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("Unable to read geo-replication statistics from ARM: %v", err))
+		} else {
+			review("ARM", stats)
+			if stats.CanFailover != nil {
+				checks = append(checks, fmt.Sprintf("failover to %s possible: %t", account.Properties.SecondaryLocation, *stats.CanFailover))
+			}
+		}
+
+		secondary := account.Properties.SecondaryEndpoints.Blob
+		if redundancy.ReadableSecondary && secondary != "" {
+			client := a.blobClient(target)
+			client.Endpoint = strings.TrimSuffix(secondary, "/")
+			stats, err := client.GetServiceStats(ctx)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("Unable to read service stats from the secondary endpoint: %v", err))
+			} else {
+				review("secondary endpoint", stats)
+			}
+		} else {
+			checks = append(checks, fmt.Sprintf("%s has no readable secondary endpoint for service stats", redundancy.Name))
+		}
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_ObjStor_C08_TR02
+	for _, policy := range policies {
+		properties := policy.Properties
+		if len(properties.Rules) == 0 {
+			failures = append(failures, fmt.Sprintf("object replication policy %s has no rules", policy.Name))
+		}
+		policyID := properties.PolicyID
+		if policyID == "" {
+			policyID = policy.Name
+		}
+		destination := strings.EqualFold(properties.DestinationAccount, account.ID) || strings.EqualFold(properties.DestinationAccount, account.Name)
+		for _, rule := range properties.Rules {
+			if destination {
+				// only the source account records whether each blob was copied
+				checks = append(checks, fmt.Sprintf("object replication policy %s rule %s receives container %s from %s, whose status is recorded on the source account",
+					policy.Name, rule.RuleID, rule.SourceContainer, resourceName(properties.SourceAccount)))
+				continue
+			}
+			status, err := a.blobClient(target).GetReplicationStatus(ctx, rule.SourceContainer, policyID, rule.RuleID)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("Unable to read the status of object replication policy %s rule %s: %v", policy.Name, rule.RuleID, err))
+				continue
+			}
+			summary := fmt.Sprintf("object replication policy %s rule %s copied %d of %d blobs in %s to %s, %d pending",
+				policy.Name, rule.RuleID, status.Complete, status.Blobs, rule.SourceContainer, resourceName(properties.DestinationAccount), status.Pending())
+			if len(status.FailedBlobs) > 0 {
+				failures = append(failures, fmt.Sprintf("%s, %d failed: %s", summary, len(status.FailedBlobs), strings.Join(status.FailedBlobs, ", ")))
+			} else {
+				checks = append(checks, summary)
+			}
+		}
+	}
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, checks...), "; ")
 	return
 }
 
@@ -659,19 +1939,160 @@ func (a *ABS) CCC_ObjStor_C01_TR01() (strikeName string, result raidengine.Strik
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_ObjStor_C01_TR01_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_ObjStor_C01_TR01_T01", a.CCC_ObjStor_C01_TR01_T01)
+	a.executeForTargets(&result, "CCC_ObjStor_C01_TR01_T02", a.CCC_ObjStor_C01_TR01_T02)
 
 	return
 }
 
-func CCC_ObjStor_C01_TR01_T01() (result raidengine.MovementResult) {
+// CCC_ObjStor_C01_TR01_T01 - Compare the account key and every encryption scope key with the trusted keys
+func (a *ABS) CCC_ObjStor_C01_TR01_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Checking the account's customer-managed key and encryption scope keys against raids.ABS.encryption.trusted_keys",
+		Function:    utils.CallerPath(0),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	trusted, err := LoadTrustedKeys()
+	if err != nil {
+		result.Message = err.Error()
+		return
+	}
+	account, err := a.ARM.GetStorageAccount(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read storage account: %v", err)
+		return
+	}
+	scopes, err := a.ARM.ListEncryptionScopes(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list encryption scopes: %v", err)
+		return
+	}
+	containers, err := a.ARM.ListContainers(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list containers: %v", err)
+		return
+	}
+
+	users := make(map[string][]string) // scope to the containers using it by default
+	for _, container := range containers {
+		scope := strings.ToLower(container.Properties.DefaultEncryptionScope)
+		users[scope] = append(users[scope], container.Name)
+	}
+
+	var checks, failures []string
+	review := func(consumer, keyURI string) {
+		reference, err := ParseKeyURI(keyURI)
+		switch {
+		case err != nil:
+			failures = append(failures, fmt.Sprintf("%s: %v", consumer, err))
+		case !trusted.Trusts(reference):
+			failures = append(failures, fmt.Sprintf("%s uses untrusted key %s", consumer, keyURI))
+		default:
+			checks = append(checks, fmt.Sprintf("%s uses trusted key %s", consumer, keyURI))
+		}
+	}
+
+	if keyURI := accountKeyURI(account); keyURI != "" {
+		review("account "+account.Name, keyURI)
+	} else {
+		checks = append(checks, fmt.Sprintf("account %s uses Microsoft-managed keys", account.Name))
+	}
+	for _, scope := range scopes {
+		consumer := fmt.Sprintf("%s encryption scope %s", strings.ToLower(scope.Properties.State), scope.Name)
+		if containers := users[strings.ToLower(scope.Name)]; len(containers) > 0 {
+			consumer += fmt.Sprintf(" (default for %s)", strings.Join(containers, ", "))
+		}
+		if strings.EqualFold(scope.Properties.Source, "Microsoft.KeyVault") {
+			review(consumer, scope.Properties.KeyVaultProperties.KeyURI)
+		} else {
+			checks = append(checks, consumer+" uses Microsoft-managed keys")
+		}
+	}
+
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, checks...), "; ")
+	return
+}
+
+// CCC_ObjStor_C01_TR01_T02 - Write with a customer-provided key, and with any untrusted encryption scope, and expect refusal
+func (a *ABS) CCC_ObjStor_C01_TR01_T02(target *Target) (result raidengine.MovementResult) {
+	result = raidengine.MovementResult{
+		Description: "Uploading blobs encrypted with a customer-provided key and with untrusted encryption scopes",
 		Function:    utils.CallerPath(0),
 	}
+	if !requireContainer(target, &result) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	trusted, err := LoadTrustedKeys()
+	if err != nil {
+		result.Message = err.Error()
+		return
+	}
+	scopes, err := a.ARM.ListEncryptionScopes(ctx, target)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list encryption scopes: %v", err)
+		return
+	}
+
+	client := a.blobClient(target)
+	// a plain write must succeed first, otherwise a refusal below could be down to permissions rather than encryption
+	baseline := testBlobName("CCC_ObjStor_C01_TR01_T02")
+	if _, err := client.PutBlob(ctx, target.Container, baseline, []byte("privateer raid")); err != nil {
+		result.Message = fmt.Sprintf("Unable to write a baseline blob to %s, so refusals cannot be attributed to encryption: %v", target.Container, err)
+		return
+	}
+	defer cleanupBlob(client, target.Container, baseline, &result)
+
+	attempts := map[string]func(blob string) error{
+		"customer-provided key": func(blob string) error {
+			return client.PutBlobWithCustomerKey(ctx, target.Container, blob, []byte("privateer raid"))
+		},
+	}
+	for _, scope := range scopes {
+		if !strings.EqualFold(scope.Properties.Source, "Microsoft.KeyVault") || scope.Properties.State != "Enabled" {
+			continue
+		}
+		if reference, err := ParseKeyURI(scope.Properties.KeyVaultProperties.KeyURI); err == nil && trusted.Trusts(reference) {
+			continue
+		}
+		name := scope.Name
+		attempts[fmt.Sprintf("encryption scope %s (key %s)", name, scope.Properties.KeyVaultProperties.KeyURI)] = func(blob string) error {
+			return client.PutBlobWithScope(ctx, target.Container, blob, name, []byte("privateer raid"))
+		}
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_ObjStor_C01_TR01
+	descriptions := make([]string, 0, len(attempts))
+	for description := range attempts {
+		descriptions = append(descriptions, description)
+	}
+	sort.Strings(descriptions)
+
+	var checks, failures []string
+	for _, description := range descriptions {
+		blob := testBlobName("CCC_ObjStor_C01_TR01_T02")
+		err := attempts[description](blob)
+		var storageErr *StorageError
+		switch {
+		case err == nil:
+			failures = append(failures, fmt.Sprintf("write with %s to %s was accepted", description, target.Container))
+			defer cleanupBlob(client, target.Container, blob, &result)
+		case encryptionRefused(err) && errors.As(err, &storageErr):
+			checks = append(checks, fmt.Sprintf("write with %s was refused with HTTP %d %s", description, storageErr.StatusCode, storageErr.Code))
+		default:
+			failures = append(failures, fmt.Sprintf("write with %s failed for a reason other than its encryption: %v", description, err))
+		}
+	}
+	result.Passed = len(failures) == 0
+	result.Message = strings.Join(append(failures, checks...), "; ")
 	return
 }
 
@@ -791,19 +2212,63 @@ func (a *ABS) CCC_ObjStor_C05_TR01() (strikeName string, result raidengine.Strik
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_ObjStor_C05_TR01_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_ObjStor_C05_TR01_T01", a.CCC_ObjStor_C05_TR01_T01)
 
 	return
 }
 
-func CCC_ObjStor_C05_TR01_T01() (result raidengine.MovementResult) {
+// CCC_ObjStor_C05_TR01_T01 - Confirm new objects in the container fall under a default retention policy
+func (a *ABS) CCC_ObjStor_C05_TR01_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Checking that the container applies a default retention policy to new objects",
 		Function:    utils.CallerPath(0),
 	}
+	if !requireContainer(target, &result) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	client := a.blobClient(target)
+
+	container, err := client.GetContainerProperties(ctx, target.Container)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read properties of container %s: %v", target.Container, err)
+		return
+	}
+	if container.Get("x-ms-has-immutability-policy") == "true" {
+		result.Passed = true
+		result.Message = fmt.Sprintf("Container %s has a container-level immutability policy covering every object", target.Container)
+		return
+	}
+	if container.Get("x-ms-immutable-storage-with-versioning-enabled") != "true" {
+		result.Message = fmt.Sprintf("Container %s has no immutability policy and version-level immutability is disabled", target.Container)
+		return
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_ObjStor_C05_TR01
+	// version-level immutability only shows the default policy on the objects it was applied to
+	name := testBlobName("CCC_ObjStor_C05_TR01_T01")
+	if _, err := client.PutBlob(ctx, target.Container, name, []byte("default retention probe")); err != nil {
+		result.Message = fmt.Sprintf("Unable to upload %s: %v", name, err)
+		return
+	}
+	// objects still under retention cannot be removed, so a cleanup failure here is reported rather than fatal
+	defer cleanupBlob(client, target.Container, name, &result)
+	blob, err := client.GetBlobProperties(ctx, target.Container, name)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read properties of %s: %v", name, err)
+		return
+	}
+	until := blob.Get("x-ms-immutability-policy-until-date")
+	if until == "" {
+		result.Message = fmt.Sprintf("New object %s did not receive a default retention policy", name)
+		return
+	}
+	result.Passed = true
+	result.Message = fmt.Sprintf("New object %s received a default retention policy (%s) until %s", name, blob.Get("x-ms-immutability-policy-mode"), until)
 	return
 }
 
@@ -824,19 +2289,62 @@ func (a *ABS) CCC_ObjStor_C05_TR04() (strikeName string, result raidengine.Strik
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_ObjStor_C05_TR04_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_ObjStor_C05_TR04_T01", a.CCC_ObjStor_C05_TR04_T01)
 
 	return
 }
 
-func CCC_ObjStor_C05_TR04_T01() (result raidengine.MovementResult) {
+// CCC_ObjStor_C05_TR04_T01 - Attempt to overwrite and delete an object under retention and confirm both are refused
+func (a *ABS) CCC_ObjStor_C05_TR04_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Attempting to overwrite and delete an object that is subject to the container's retention policy",
 		Function:    utils.CallerPath(0),
 	}
+	if !requireContainer(target, &result) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	client := a.blobClient(target)
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_ObjStor_C05_TR04
+	name := testBlobName("CCC_ObjStor_C05_TR04_T01")
+	if _, err := client.PutBlob(ctx, target.Container, name, []byte("retention probe")); err != nil {
+		result.Message = fmt.Sprintf("Unable to upload %s: %v", name, err)
+		return
+	}
+	// the object is expected to outlive the movement while retention applies, so a cleanup failure is only reported
+	defer cleanupBlob(client, target.Container, name, &result)
+
+	var outcomes []string
+	result.Passed = true
+	for _, attempt := range []struct {
+		action string
+		call   func() error
+	}{
+		{"overwrite", func() error {
+			_, err := client.PutBlob(ctx, target.Container, name, []byte("modified retention probe"))
+			return err
+		}},
+		{"delete", func() error { return client.DeleteBlob(ctx, target.Container, name) }},
+	} {
+		err := attempt.call()
+		var storageErr *StorageError
+		if errors.As(err, &storageErr) && storageErr.StatusCode == http.StatusConflict {
+			outcomes = append(outcomes, fmt.Sprintf("%s refused (%s)", attempt.action, storageErr.Code))
+			continue
+		}
+		result.Passed = false
+		if err != nil {
+			outcomes = append(outcomes, fmt.Sprintf("%s failed unexpectedly: %v", attempt.action, err))
+		} else {
+			outcomes = append(outcomes, fmt.Sprintf("%s succeeded", attempt.action))
+		}
+	}
+	result.Message = fmt.Sprintf("Object %s: %s", name, strings.Join(outcomes, "; "))
 	return
 }
 
@@ -857,19 +2365,54 @@ func (a *ABS) CCC_ObjStor_C06_TR01() (strikeName string, result raidengine.Strik
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_ObjStor_C06_TR01_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_ObjStor_C06_TR01_T01", a.CCC_ObjStor_C06_TR01_T01)
 
 	return
 }
 
-func CCC_ObjStor_C06_TR01_T01() (result raidengine.MovementResult) {
+// CCC_ObjStor_C06_TR01_T01 - Upload two objects with the same name and confirm both are kept under unique version IDs
+func (a *ABS) CCC_ObjStor_C06_TR01_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Uploading two objects with the same name and listing the stored versions",
 		Function:    utils.CallerPath(0),
 	}
+	if !requireContainer(target, &result) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	client := a.blobClient(target)
+
+	name := testBlobName("CCC_ObjStor_C06_TR01_T01")
+	defer cleanupBlob(client, target.Container, name, &result)
+	for i, content := range []string{"first upload", "second upload"} {
+		if _, err := client.PutBlob(ctx, target.Container, name, []byte(content)); err != nil {
+			result.Message = fmt.Sprintf("Upload %d of %s failed: %v", i+1, name, err)
+			return
+		}
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_ObjStor_C06_TR01
+	items, err := client.ListBlobVersions(ctx, target.Container, name)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to list versions of %s: %v", name, err)
+		return
+	}
+	versions := make(map[string]bool)
+	for _, item := range items {
+		if item.Name == name && item.VersionID != "" {
+			versions[item.VersionID] = true
+		}
+	}
+	if len(versions) < 2 {
+		result.Message = fmt.Sprintf("Found %d version(s) of %s after two uploads, so the first object was overwritten", len(versions), name)
+		return
+	}
+	result.Passed = true
+	result.Message = fmt.Sprintf("Both uploads of %s were stored with unique version IDs", name)
 	return
 }
 
@@ -890,19 +2433,70 @@ func (a *ABS) CCC_ObjStor_C06_TR04() (strikeName string, result raidengine.Strik
 		Movements:   make(map[string]raidengine.MovementResult),
 	}
 
-	raidengine.ExecuteMovement(&result, CCC_ObjStor_C06_TR04_T01)
-	// TODO: Additional movement calls go here
+	if !a.ready(&result) {
+		return
+	}
+
+	a.executeForTargets(&result, "CCC_ObjStor_C06_TR04_T01", a.CCC_ObjStor_C06_TR04_T01)
 
 	return
 }
 
-func CCC_ObjStor_C06_TR04_T01() (result raidengine.MovementResult) {
+// CCC_ObjStor_C06_TR04_T01 - Modify an object, then read and restore its previous version
+func (a *ABS) CCC_ObjStor_C06_TR04_T01(target *Target) (result raidengine.MovementResult) {
 	result = raidengine.MovementResult{
-		Description: "This movement is still under construction",
+		Description: "Modifying an object and restoring its previous version",
 		Function:    utils.CallerPath(0),
 	}
+	if !requireContainer(target, &result) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	client := a.blobClient(target)
+
+	name := testBlobName("CCC_ObjStor_C06_TR04_T01")
+	defer cleanupBlob(client, target.Container, name, &result)
+	original := []byte("original content")
+	versionID, err := client.PutBlob(ctx, target.Container, name, original)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to upload %s: %v", name, err)
+		return
+	}
+	if versionID == "" {
+		result.Message = fmt.Sprintf("Upload of %s was not assigned a version ID, so blob versioning is disabled", name)
+		return
+	}
+	if _, err := client.PutBlob(ctx, target.Container, name, []byte("modified content")); err != nil {
+		result.Message = fmt.Sprintf("Unable to modify %s: %v", name, err)
+		return
+	}
 
-	// TODO: Use this section to write a single step or test that contributes to CCC_ObjStor_C06_TR04
+	previous, err := client.GetBlob(ctx, target.Container, name, versionID)
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read previous version %s of %s: %v", versionID, name, err)
+		return
+	}
+	if !bytes.Equal(previous, original) {
+		result.Message = fmt.Sprintf("Previous version %s of %s does not contain the original content", versionID, name)
+		return
+	}
+
+	if err := client.RestoreBlobVersion(ctx, target.Container, name, versionID); err != nil {
+		result.Message = fmt.Sprintf("Unable to restore version %s of %s: %v", versionID, name, err)
+		return
+	}
+	current, err := client.GetBlob(ctx, target.Container, name, "")
+	if err != nil {
+		result.Message = fmt.Sprintf("Unable to read %s after restoring: %v", name, err)
+		return
+	}
+	if !bytes.Equal(current, original) {
+		result.Message = fmt.Sprintf("%s does not contain the original content after restoring version %s", name, versionID)
+		return
+	}
+	result.Passed = true
+	result.Message = fmt.Sprintf("Previous version %s of %s was read and restored", versionID, name)
 	return
 }
 
@@ -0,0 +1,134 @@
+package armory
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestEncryptionAtRestFromRecordedAccount(t *testing.T) {
+	target := recordedTarget()
+	_, arm := newFakeARM(t, map[string]string{
+		"GET " + target.ResourceID(): recordedFixture(t, "storage-account.json"),
+	})
+	abs := &ABS{ARM: arm}
+
+	result := abs.CCC_C02_TR01_T01(target)
+	if !result.Passed {
+		t.Errorf("recorded account failed: %s", result.Message)
+	}
+	for _, want := range []string{"blob service encryption enabled", "file service encryption enabled", "key source Microsoft.Storage", "requireInfrastructureEncryption true"} {
+		if !strings.Contains(result.Message, want) {
+			t.Errorf("%q missing from %q", want, result.Message)
+		}
+	}
+
+	viper.Set("raids.ABS.encryption.require_infrastructure_encryption", false)
+	t.Cleanup(viper.Reset)
+	result = abs.CCC_C02_TR01_T01(target)
+	if result.Passed || !strings.Contains(result.Message, "requireInfrastructureEncryption is true but policy requires false") {
+		t.Errorf("policy mismatch was not reported: passed=%t %s", result.Passed, result.Message)
+	}
+}
+
+func TestContainerEncryptionScopesFromRecordedAccount(t *testing.T) {
+	target := recordedTarget()
+	_, arm := newFakeARM(t, map[string]string{
+		"GET " + target.ResourceID() + "/encryptionScopes":                recordedFixture(t, "encryption-scopes.json"),
+		"GET " + target.ResourceID() + "/blobServices/default/containers": recordedFixture(t, "containers.json"),
+	})
+	abs := &ABS{ARM: arm}
+
+	result := abs.CCC_C02_TR01_T02(target)
+	if result.Passed {
+		t.Errorf("a container on a disabled scope passed: %s", result.Message)
+	}
+	for _, want := range []string{
+		"container cold uses scope archive which is Disabled",
+		"container ledgers uses enabled scope finance",
+		"container logs uses the account encryption key",
+	} {
+		if !strings.Contains(result.Message, want) {
+			t.Errorf("%q missing from %q", want, result.Message)
+		}
+	}
+}
+
+func TestUntrustedEncryptionWritesAreRefused(t *testing.T) {
+	target := recordedTarget()
+	target.Container = "raid"
+	_, arm := newFakeARM(t, map[string]string{
+		"GET " + target.ResourceID() + "/encryptionScopes": `{"value":[` +
+			`{"name":"trusted","properties":{"source":"Microsoft.KeyVault","state":"Enabled","keyVaultProperties":{"keyUri":"https://corp.vault.azure.net/keys/storage"}}},` +
+			`{"name":"rogue","properties":{"source":"Microsoft.KeyVault","state":"Enabled","keyVaultProperties":{"keyUri":"https://rogue.vault.azure.net/keys/storage"}}}]}`,
+	})
+	viper.Set("raids.ABS.encryption.trusted_keys", []string{"https://corp.vault.azure.net/keys/storage"})
+	t.Cleanup(viper.Reset)
+
+	var baseline, scope, customerKey [2]string // HTTP status and error code returned for each kind of write
+	blob, client := newFakeBlobService(t, func(w http.ResponseWriter, r *http.Request) {
+		respond := func(outcome [2]string) {
+			if outcome[1] != "" {
+				w.Header().Set("x-ms-error-code", outcome[1])
+			}
+			status, _ := strconv.Atoi(outcome[0])
+			w.WriteHeader(status)
+		}
+		switch {
+		case r.Method == http.MethodGet:
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs/><NextMarker/></EnumerationResults>`))
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusAccepted)
+		case r.Header.Get("x-ms-encryption-scope") == "trusted":
+			t.Error("a write with a trusted encryption scope was attempted")
+		case r.Header.Get("x-ms-encryption-scope") != "":
+			respond(scope)
+		case r.Header.Get("x-ms-encryption-key") != "":
+			respond(customerKey)
+		default:
+			respond(baseline)
+		}
+	})
+	target.Endpoints.Blob = blob.URL
+	abs := &ABS{ARM: arm, Credential: staticCredential{}, HTTPClient: client.HTTPClient}
+
+	baseline = [2]string{"201", ""}
+	customerKey = [2]string{"409", "EncryptionScopeOverrideNotAllowed"}
+	scope = [2]string{"403", "KeyVaultEncryptionKeyNotFound"}
+	result := abs.CCC_ObjStor_C01_TR01_T02(target)
+	if !result.Passed || !strings.Contains(result.Message, "encryption scope rogue (key https://rogue.vault.azure.net/keys/storage) was refused with HTTP 403") {
+		t.Errorf("passed=%t %s", result.Passed, result.Message)
+	}
+	if !strings.HasPrefix(blob.requests[0], "PUT /raid/privateer-raid/") || !strings.Contains(strings.Join(blob.requests, "\n"), "DELETE "+strings.Fields(blob.requests[0])[1]) {
+		t.Errorf("the baseline blob was not written first and cleaned up: %v", blob.requests)
+	}
+
+	scope = [2]string{"403", "AuthorizationPermissionMismatch"}
+	result = abs.CCC_ObjStor_C01_TR01_T02(target)
+	if result.Passed || !strings.Contains(result.Message, "rogue (key https://rogue.vault.azure.net/keys/storage) failed for a reason other than its encryption") {
+		t.Errorf("a permissions refusal was taken as an encryption refusal: %s", result.Message)
+	}
+
+	scope = [2]string{"403", "KeyVaultEncryptionKeyNotFound"}
+	customerKey = [2]string{"409", "LeaseIdMissing"}
+	result = abs.CCC_ObjStor_C01_TR01_T02(target)
+	if result.Passed || !strings.Contains(result.Message, "write with customer-provided key failed for a reason other than its encryption") {
+		t.Errorf("a lease conflict was taken as an encryption refusal: %s", result.Message)
+	}
+
+	customerKey = [2]string{"409", "EncryptionScopeOverrideNotAllowed"}
+	scope = [2]string{"201", ""}
+	result = abs.CCC_ObjStor_C01_TR01_T02(target)
+	if result.Passed || !strings.Contains(result.Message, "write with encryption scope rogue (key https://rogue.vault.azure.net/keys/storage) to raid was accepted") {
+		t.Errorf("an accepted untrusted write passed: %s", result.Message)
+	}
+
+	baseline = [2]string{"403", "AuthorizationPermissionMismatch"}
+	result = abs.CCC_ObjStor_C01_TR01_T02(target)
+	if result.Passed || !strings.HasPrefix(result.Message, "Unable to write a baseline blob to raid") {
+		t.Errorf("expected the refused baseline to stop the movement: %s", result.Message)
+	}
+}
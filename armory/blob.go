@@ -0,0 +1,573 @@
+package armory
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/privateerproj/privateer-sdk/raidengine"
+)
+
+// Version of the Blob service REST API sent on every data-plane request
+const blobServiceVersion = "2021-12-02"
+
+// Well-known development storage account used by Azurite and the legacy storage emulator
+const (
+	EmulatorAccountName         = "devstoreaccount1"
+	EmulatorAccountKey          = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	defaultEmulatorBlobEndpoint = "http://127.0.0.1:10000/devstoreaccount1"
+)
+
+// EmulatorConfig selects a local Blob-compatible emulator in place of the real data plane
+type EmulatorConfig struct {
+	Enabled      bool
+	BlobEndpoint string
+	AccountName  string
+	AccountKey   string
+}
+
+// LoadEmulatorConfig reads raids.ABS.emulator, defaulting to Azurite's well-known endpoint and account
+func LoadEmulatorConfig() EmulatorConfig {
+	config := EmulatorConfig{
+		Enabled:      viper.GetBool("raids.ABS.emulator.enabled"),
+		BlobEndpoint: viper.GetString("raids.ABS.emulator.blob_endpoint"),
+		AccountName:  viper.GetString("raids.ABS.emulator.account_name"),
+		AccountKey:   viper.GetString("raids.ABS.emulator.account_key"),
+	}
+	if config.BlobEndpoint == "" {
+		config.BlobEndpoint = defaultEmulatorBlobEndpoint
+	}
+	if config.AccountName == "" {
+		config.AccountName = EmulatorAccountName
+	}
+	if config.AccountKey == "" {
+		config.AccountKey = EmulatorAccountKey
+	}
+	return config
+}
+
+// SharedKeyCredential signs data-plane requests with a storage account key
+type SharedKeyCredential struct {
+	AccountName string
+	AccountKey  string
+}
+
+// Sign adds the SharedKey Authorization header to request
+func (c *SharedKeyCredential) Sign(request *http.Request) error {
+	key, err := base64.StdEncoding.DecodeString(c.AccountKey)
+	if err != nil {
+		return fmt.Errorf("account key is not valid base64: %v", err)
+	}
+
+	contentLength := ""
+	if request.ContentLength > 0 {
+		contentLength = strconv.FormatInt(request.ContentLength, 10)
+	}
+	headers := request.Header
+	stringToSign := strings.Join([]string{
+		request.Method,
+		headers.Get("Content-Encoding"),
+		headers.Get("Content-Language"),
+		contentLength,
+		headers.Get("Content-MD5"),
+		headers.Get("Content-Type"),
+		"", // Date is always sent as x-ms-date
+		headers.Get("If-Modified-Since"),
+		headers.Get("If-Match"),
+		headers.Get("If-None-Match"),
+		headers.Get("If-Unmodified-Since"),
+		headers.Get("Range"),
+	}, "\n") + "\n" + c.canonicalizedHeaders(headers) + c.canonicalizedResource(request.URL)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	request.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", c.AccountName, signature))
+	return nil
+}
+
+func (c *SharedKeyCredential) canonicalizedHeaders(headers http.Header) string {
+	var names []string
+	for name := range headers {
+		if strings.HasPrefix(strings.ToLower(name), "x-ms-") {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	for _, name := range names {
+		builder.WriteString(name + ":" + strings.TrimSpace(headers.Get(name)) + "\n")
+	}
+	return builder.String()
+}
+
+func (c *SharedKeyCredential) canonicalizedResource(requestURL *url.URL) string {
+	path := requestURL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	resource := "/" + c.AccountName + path
+
+	query := requestURL.Query()
+	var names []string
+	for name := range query {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		resource += "\n" + name + ":" + strings.Join(values, ",")
+	}
+	return resource
+}
+
+// StorageError is returned when the data plane responds with a non-success status
+type StorageError struct {
+	StatusCode int
+	Code       string
+}
+
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("storage request failed with HTTP %d: %s", e.StatusCode, e.Code)
+}
+
+// encryptionRefused reports whether err is the service refusing a write because of how it asked to be encrypted:
+// a conflict with the container's enforced encryption scope, or a request rejected over its encryption scope or key.
+// Other refusals, such as missing permissions, leases or immutability policies, say nothing about the encryption policy.
+func encryptionRefused(err error) bool {
+	var storageErr *StorageError
+	if !errors.As(err, &storageErr) {
+		return false
+	}
+	code := strings.ToLower(storageErr.Code)
+	switch storageErr.StatusCode {
+	case http.StatusBadRequest, http.StatusForbidden, http.StatusConflict:
+		// BlobUsesCustomerSpecifiedEncryption answers a read that lacks the blob's key, not a write
+		if code == "blobusescustomerspecifiedencryption" {
+			return false
+		}
+		return strings.Contains(code, "encryption") || strings.Contains(code, "keyvault")
+	}
+	return false
+}
+
+// BlobClient makes requests against the Blob service of a single storage account
+type BlobClient struct {
+	Endpoint   string
+	SharedKey  *SharedKeyCredential // Used when set, otherwise requests carry a bearer token from Credential
+	Credential TokenCredential
+	Scope      string
+	HTTPClient *http.Client
+
+	ClientRequestID string // Sent as x-ms-client-request-id when set, so the requests can be found in StorageBlobLogs
+}
+
+// blobClient returns a data-plane client for target's blob endpoint
+func (a *ABS) blobClient(target *Target) *BlobClient {
+	return &BlobClient{
+		Endpoint:   strings.TrimSuffix(target.Endpoints.Blob, "/"),
+		SharedKey:  target.SharedKey,
+		Credential: a.Credential,
+		Scope:      target.Cloud.StorageScope,
+		HTTPClient: a.HTTPClient,
+	}
+}
+
+func (c *BlobClient) blobURL(container, blob string, query url.Values) string {
+	location := c.Endpoint + "/" + url.PathEscape(container)
+	if blob != "" {
+		segments := strings.Split(blob, "/")
+		for i, segment := range segments {
+			segments[i] = url.PathEscape(segment)
+		}
+		location += "/" + strings.Join(segments, "/")
+	}
+	if len(query) > 0 {
+		location += "?" + query.Encode()
+	}
+	return location
+}
+
+// do sends an authenticated request and returns the response with its body fully read
+func (c *BlobClient) do(ctx context.Context, method, requestURL string, headers map[string]string, body []byte) (*http.Response, []byte, error) {
+	request, err := http.NewRequestWithContext(ctx, method, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	request.ContentLength = int64(len(body))
+	request.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	request.Header.Set("x-ms-version", blobServiceVersion)
+	if c.ClientRequestID != "" {
+		request.Header.Set("x-ms-client-request-id", c.ClientRequestID)
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	if c.SharedKey != nil {
+		if err := c.SharedKey.Sign(request); err != nil {
+			return nil, nil, err
+		}
+	} else if c.Credential != nil {
+		token, err := c.Credential.GetToken(ctx, c.Scope)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to authenticate to the storage data plane: %v", err)
+		}
+		request.Header.Set("Authorization", "Bearer "+token.Token)
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response, data, &StorageError{StatusCode: response.StatusCode, Code: response.Header.Get("x-ms-error-code")}
+	}
+	return response, data, nil
+}
+
+// PutBlob uploads content as a block blob and returns the version ID assigned to it, if versioning is enabled
+func (c *BlobClient) PutBlob(ctx context.Context, container, blob string, content []byte) (string, error) {
+	response, _, err := c.do(ctx, http.MethodPut, c.blobURL(container, blob, nil), map[string]string{
+		"x-ms-blob-type": "BlockBlob",
+		"Content-Type":   "text/plain",
+	}, content)
+	if err != nil {
+		return "", err
+	}
+	return response.Header.Get("x-ms-version-id"), nil
+}
+
+// PutBlobWithScope uploads content as a block blob encrypted with the named encryption scope
+func (c *BlobClient) PutBlobWithScope(ctx context.Context, container, blob, scope string, content []byte) error {
+	_, _, err := c.do(ctx, http.MethodPut, c.blobURL(container, blob, nil), map[string]string{
+		"x-ms-blob-type":        "BlockBlob",
+		"Content-Type":          "text/plain",
+		"x-ms-encryption-scope": scope,
+	}, content)
+	return err
+}
+
+// PutBlobWithCustomerKey uploads content as a block blob encrypted with a random customer-provided key
+func (c *BlobClient) PutBlobWithCustomerKey(ctx context.Context, container, blob string, content []byte) error {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	digest := sha256.Sum256(key)
+	_, _, err := c.do(ctx, http.MethodPut, c.blobURL(container, blob, nil), map[string]string{
+		"x-ms-blob-type":             "BlockBlob",
+		"Content-Type":               "text/plain",
+		"x-ms-encryption-key":        base64.StdEncoding.EncodeToString(key),
+		"x-ms-encryption-key-sha256": base64.StdEncoding.EncodeToString(digest[:]),
+		"x-ms-encryption-algorithm":  "AES256",
+	}, content)
+	return err
+}
+
+// GetBlob downloads the current blob, or the given version when versionID is set
+func (c *BlobClient) GetBlob(ctx context.Context, container, blob, versionID string) ([]byte, error) {
+	query := url.Values{}
+	if versionID != "" {
+		query.Set("versionid", versionID)
+	}
+	_, data, err := c.do(ctx, http.MethodGet, c.blobURL(container, blob, query), nil, nil)
+	return data, err
+}
+
+// DeleteBlob deletes the current blob
+func (c *BlobClient) DeleteBlob(ctx context.Context, container, blob string) error {
+	_, _, err := c.do(ctx, http.MethodDelete, c.blobURL(container, blob, nil), nil, nil)
+	return err
+}
+
+// DeleteBlobVersions deletes blob and then every previous version of it that versioning kept
+func (c *BlobClient) DeleteBlobVersions(ctx context.Context, container, blob string) error {
+	var failures []string
+	if err := c.DeleteBlob(ctx, container, blob); err != nil && !isNotFound(err) {
+		failures = append(failures, fmt.Sprintf("current version: %v", err))
+	}
+	items, err := c.ListBlobVersions(ctx, container, blob)
+	if err != nil {
+		return fmt.Errorf("unable to list versions of %s: %v", blob, err)
+	}
+	for _, item := range items {
+		if item.Name != blob || item.VersionID == "" {
+			continue
+		}
+		_, _, err := c.do(ctx, http.MethodDelete, c.blobURL(container, blob, url.Values{"versionid": {item.VersionID}}), nil, nil)
+		if err != nil && !isNotFound(err) {
+			failures = append(failures, fmt.Sprintf("version %s: %v", item.VersionID, err))
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// isNotFound reports whether err is the Blob service answering 404
+func isNotFound(err error) bool {
+	var storageErr *StorageError
+	return errors.As(err, &storageErr) && storageErr.StatusCode == http.StatusNotFound
+}
+
+// GetBlobProperties returns the headers describing blob without downloading it
+func (c *BlobClient) GetBlobProperties(ctx context.Context, container, blob string) (http.Header, error) {
+	response, _, err := c.do(ctx, http.MethodHead, c.blobURL(container, blob, nil), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return response.Header, nil
+}
+
+// RestoreBlobVersion copies a previous version over the current blob and waits for the copy to finish
+func (c *BlobClient) RestoreBlobVersion(ctx context.Context, container, blob, versionID string) error {
+	source := c.blobURL(container, blob, url.Values{"versionid": {versionID}})
+	response, _, err := c.do(ctx, http.MethodPut, c.blobURL(container, blob, nil), map[string]string{
+		"x-ms-copy-source": source,
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	status := response.Header.Get("x-ms-copy-status")
+	for attempt := 0; status == "pending" && attempt < 10; attempt++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+		headers, err := c.GetBlobProperties(ctx, container, blob)
+		if err != nil {
+			return err
+		}
+		status = headers.Get("x-ms-copy-status")
+	}
+	if status != "success" {
+		return fmt.Errorf("copy from version %s finished with status %q", versionID, status)
+	}
+	return nil
+}
+
+// GetWithForgedSAS reads blob with a SAS token whose signature is random, without any other credential, and returns the HTTP status
+func (c *BlobClient) GetWithForgedSAS(ctx context.Context, container, blob string) (int, error) {
+	signature := make([]byte, 32)
+	_, _ = rand.Read(signature)
+	query := url.Values{
+		"sv":  {blobServiceVersion},
+		"sr":  {"b"},
+		"sp":  {"r"},
+		"se":  {time.Now().Add(time.Hour).UTC().Format(time.RFC3339)},
+		"sig": {base64.StdEncoding.EncodeToString(signature)},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.blobURL(container, blob, query), nil)
+	if err != nil {
+		return 0, err
+	}
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	return response.StatusCode, nil
+}
+
+// BlobItem is a single entry returned by ListBlobs
+type BlobItem struct {
+	Name             string `xml:"Name"`
+	VersionID        string `xml:"VersionId"`
+	IsCurrentVersion bool   `xml:"IsCurrentVersion"`
+}
+
+// ListBlobVersions returns every blob, including previous versions, whose name starts with prefix
+func (c *BlobClient) ListBlobVersions(ctx context.Context, container, prefix string) ([]BlobItem, error) {
+	var items []BlobItem
+	marker := ""
+	for {
+		query := url.Values{
+			"restype": {"container"},
+			"comp":    {"list"},
+			"include": {"versions"},
+			"prefix":  {prefix},
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		_, data, err := c.do(ctx, http.MethodGet, c.blobURL(container, "", query), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Blobs      []BlobItem `xml:"Blobs>Blob"`
+			NextMarker string     `xml:"NextMarker"`
+		}
+		if err := xml.Unmarshal(data, &page); err != nil {
+			return nil, fmt.Errorf("unable to parse blob listing: %v", err)
+		}
+		items = append(items, page.Blobs...)
+		if page.NextMarker == "" {
+			return items, nil
+		}
+		marker = page.NextMarker
+	}
+}
+
+// GetServiceStats reads the geo-replication statistics of the Blob service. Azure serves them only from the
+// secondary endpoint of a read-access geo-redundant account.
+func (c *BlobClient) GetServiceStats(ctx context.Context) (*GeoReplicationStats, error) {
+	_, data, err := c.do(ctx, http.MethodGet, c.Endpoint+"/?restype=service&comp=stats", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var stats struct {
+		Status       string `xml:"GeoReplication>Status"`
+		LastSyncTime string `xml:"GeoReplication>LastSyncTime"`
+	}
+	if err := xml.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("unable to parse service stats: %v", err)
+	}
+	result := &GeoReplicationStats{Status: stats.Status}
+	if stats.LastSyncTime != "" {
+		if result.LastSyncTime, err = http.ParseTime(stats.LastSyncTime); err != nil {
+			return nil, fmt.Errorf("unable to parse last sync time %q: %v", stats.LastSyncTime, err)
+		}
+	}
+	return result, nil
+}
+
+// ReplicationStatus tallies the object replication status of the blobs in a source container for one rule
+type ReplicationStatus struct {
+	Blobs       int
+	Complete    int
+	FailedBlobs []string
+}
+
+// Pending returns the number of blobs the rule has neither copied nor given up on
+func (s *ReplicationStatus) Pending() int {
+	return s.Blobs - s.Complete - len(s.FailedBlobs)
+}
+
+// GetReplicationStatus lists every blob in container and tallies the status the source account records for
+// rule ruleID of object replication policy policyID. Blobs without a status have not been copied yet.
+func (c *BlobClient) GetReplicationStatus(ctx context.Context, container, policyID, ruleID string) (*ReplicationStatus, error) {
+	// each status is an element named Or-<policy ID>_<rule ID> holding complete or failed
+	element := "or-" + strings.ToLower(policyID+"_"+ruleID)
+	status := &ReplicationStatus{}
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		_, data, err := c.do(ctx, http.MethodGet, c.blobURL(container, "", query), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Blobs []struct {
+				Name       string `xml:"Name"`
+				OrMetadata struct {
+					Rules []struct {
+						XMLName xml.Name
+						Status  string `xml:",chardata"`
+					} `xml:",any"`
+				} `xml:"OrMetadata"`
+			} `xml:"Blobs>Blob"`
+			NextMarker string `xml:"NextMarker"`
+		}
+		if err := xml.Unmarshal(data, &page); err != nil {
+			return nil, fmt.Errorf("unable to parse blob listing: %v", err)
+		}
+		status.Blobs += len(page.Blobs)
+		for _, blob := range page.Blobs {
+			for _, rule := range blob.OrMetadata.Rules {
+				if strings.ToLower(rule.XMLName.Local) != element {
+					continue
+				}
+				switch value := strings.ToLower(strings.TrimSpace(rule.Status)); {
+				case strings.HasPrefix(value, "complete"):
+					status.Complete++
+				case strings.HasPrefix(value, "fail"):
+					status.FailedBlobs = append(status.FailedBlobs, blob.Name)
+				}
+			}
+		}
+		if page.NextMarker == "" {
+			return status, nil
+		}
+		marker = page.NextMarker
+	}
+}
+
+// ListContainers returns the names of the containers in the account, reading only the first page
+func (c *BlobClient) ListContainers(ctx context.Context) ([]string, error) {
+	_, data, err := c.do(ctx, http.MethodGet, c.Endpoint+"/?comp=list", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var page struct {
+		Names []string `xml:"Containers>Container>Name"`
+	}
+	if err := xml.Unmarshal(data, &page); err != nil {
+		return nil, fmt.Errorf("unable to parse container listing: %v", err)
+	}
+	return page.Names, nil
+}
+
+// GetContainerProperties returns the headers describing container, including its immutability settings
+func (c *BlobClient) GetContainerProperties(ctx context.Context, container string) (http.Header, error) {
+	response, _, err := c.do(ctx, http.MethodGet, c.blobURL(container, "", url.Values{"restype": {"container"}}), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return response.Header, nil
+}
+
+// testBlobName returns a unique blob name so concurrent raids never collide
+func testBlobName(movement string) string {
+	suffix := make([]byte, 6)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("privateer-raid/%s-%s.txt", strings.ToLower(movement), hex.EncodeToString(suffix))
+}
+
+// cleanupBlob deletes every version of a blob a movement uploaded, noting any failure in the movement message.
+// It uses its own deadline so that cleanup still runs after the movement's context has expired.
+func cleanupBlob(client *BlobClient, container, blob string, result *raidengine.MovementResult) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := client.DeleteBlobVersions(ctx, container, blob); err != nil {
+		result.Message += fmt.Sprintf("; unable to clean up %s: %v", blob, err)
+	}
+}
+
+// requireContainer fails result when the target has no container for data-plane movements to use
+func requireContainer(target *Target, result *raidengine.MovementResult) bool {
+	if target.Container == "" {
+		result.Passed = false
+		result.Message = "raids.ABS.container must be set for movements that read or write blobs"
+		return false
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package armory
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/privateerproj/privateer-sdk/raidengine"
+)
+
+// fakeBlobService answers Blob REST requests through handler and records each request as "METHOD /path?query"
+type fakeBlobService struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests []string
+}
+
+func newFakeBlobService(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) (*fakeBlobService, *BlobClient) {
+	fake := &fakeBlobService{}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.mutex.Lock()
+		fake.requests = append(fake.requests, r.Method+" "+r.URL.RequestURI())
+		fake.mutex.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(fake.Close)
+	return fake, &BlobClient{Endpoint: fake.URL, Credential: staticCredential{}, HTTPClient: fake.Client()}
+}
+
+func TestDeleteBlobVersions(t *testing.T) {
+	var deletedVersions []string
+	fake, client := newFakeBlobService(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("comp") == "list":
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>` +
+				`<Blob><Name>probe.txt</Name><VersionId>v1</VersionId></Blob>` +
+				`<Blob><Name>probe.txt</Name><VersionId>v2</VersionId></Blob>` +
+				`<Blob><Name>probe.txt.other</Name><VersionId>v3</VersionId></Blob>` +
+				`</Blobs><NextMarker/></EnumerationResults>`))
+		case r.Method == http.MethodDelete && r.URL.Query().Get("versionid") == "v2":
+			w.Header().Set("x-ms-error-code", "BlobImmutableDueToPolicy")
+			w.WriteHeader(http.StatusConflict)
+		case r.Method == http.MethodDelete && r.URL.Query().Get("versionid") != "":
+			deletedVersions = append(deletedVersions, r.URL.Query().Get("versionid"))
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodDelete:
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	})
+
+	err := client.DeleteBlobVersions(context.Background(), "raid", "probe.txt")
+	if err == nil || !strings.Contains(err.Error(), "version v2") || !strings.Contains(err.Error(), "BlobImmutableDueToPolicy") {
+		t.Errorf("expected the refused version to be reported, got %v", err)
+	}
+	if strings.Join(deletedVersions, ",") != "v1" {
+		t.Errorf("deleted versions %v, want only v1 of probe.txt", deletedVersions)
+	}
+	if !strings.HasPrefix(fake.requests[0], "DELETE /raid/probe.txt") || strings.Contains(fake.requests[0], "versionid") {
+		t.Errorf("first request %s should delete the current version", fake.requests[0])
+	}
+}
+
+func TestCleanupBlobReportsFailures(t *testing.T) {
+	_, client := newFakeBlobService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ms-error-code", "AuthorizationPermissionMismatch")
+		w.WriteHeader(http.StatusForbidden)
+	})
+	movement := raidengine.MovementResult{Passed: true, Message: "uploaded probe.txt"}
+	cleanupBlob(client, "raid", "probe.txt", &movement)
+	if !strings.Contains(movement.Message, "unable to clean up probe.txt") {
+		t.Errorf("cleanup failure missing from %q", movement.Message)
+	}
+	if !movement.Passed {
+		t.Error("a cleanup failure should be reported without changing the movement outcome")
+	}
+}
+
+func TestGetServiceStats(t *testing.T) {
+	body := ""
+	_, client := newFakeBlobService(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("restype") != "service" || r.URL.Query().Get("comp") != "stats" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(body))
+	})
+
+	body = `<?xml version="1.0" encoding="utf-8"?><StorageServiceStats><GeoReplication>` +
+		`<Status>live</Status><LastSyncTime>Wed, 14 Oct 2026 09:00:00 GMT</LastSyncTime>` +
+		`</GeoReplication></StorageServiceStats>`
+	stats, err := client.GetServiceStats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Status != "live" || !stats.LastSyncTime.Equal(time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("parsed %+v", stats)
+	}
+
+	body = `<?xml version="1.0" encoding="utf-8"?><StorageServiceStats><GeoReplication>` +
+		`<Status>bootstrap</Status><LastSyncTime></LastSyncTime>` +
+		`</GeoReplication></StorageServiceStats>`
+	stats, err = client.GetServiceStats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, synced := stats.Lag(time.Now()); stats.Status != "bootstrap" || synced {
+		t.Errorf("a bootstrapping secondary should report no completed sync, got %+v", stats)
+	}
+
+	body = `<?xml version="1.0" encoding="utf-8"?><StorageServiceStats><GeoReplication>` +
+		`<Status>live</Status><LastSyncTime>yesterday</LastSyncTime>` +
+		`</GeoReplication></StorageServiceStats>`
+	if _, err := client.GetServiceStats(context.Background()); err == nil || !strings.Contains(err.Error(), "yesterday") {
+		t.Errorf("expected an unparseable last sync time to be reported, got %v", err)
+	}
+}
+
+func TestGetReplicationStatus(t *testing.T) {
+	fake, client := newFakeBlobService(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("marker") == "" {
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>` +
+				`<Blob><Name>a.txt</Name><OrMetadata><Or-policy-1_rule-1>complete</Or-policy-1_rule-1><Or-policy-1_rule-2>failed</Or-policy-1_rule-2></OrMetadata></Blob>` +
+				`<Blob><Name>b.txt</Name><OrMetadata><Or-policy-1_rule-1>failed</Or-policy-1_rule-1></OrMetadata></Blob>` +
+				`</Blobs><NextMarker>page2</NextMarker></EnumerationResults>`))
+			return
+		}
+		w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>` +
+			`<Blob><Name>c.txt</Name></Blob>` +
+			`<Blob><Name>d.txt</Name><OrMetadata><Or-policy-1_rule-1>Complete</Or-policy-1_rule-1></OrMetadata></Blob>` +
+			`</Blobs><NextMarker/></EnumerationResults>`))
+	})
+
+	status, err := client.GetReplicationStatus(context.Background(), "source", "policy-1", "rule-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Blobs != 4 || status.Complete != 2 || strings.Join(status.FailedBlobs, ",") != "b.txt" || status.Pending() != 1 {
+		t.Errorf("tallied %+v", status)
+	}
+	if len(fake.requests) != 2 || !strings.Contains(fake.requests[1], "marker=page2") {
+		t.Errorf("expected the listing to follow NextMarker, got %v", fake.requests)
+	}
+}
+
+func TestEncryptionRefused(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{&StorageError{StatusCode: http.StatusConflict, Code: "EncryptionScopeOverrideNotAllowed"}, true},
+		{&StorageError{StatusCode: http.StatusConflict, Code: "BlobUsesCustomerSpecifiedEncryption"}, false},
+		{&StorageError{StatusCode: http.StatusConflict, Code: "LeaseIdMissing"}, false},
+		{&StorageError{StatusCode: http.StatusConflict, Code: "BlobImmutableDueToPolicy"}, false},
+		{&StorageError{StatusCode: http.StatusForbidden, Code: "KeyVaultEncryptionKeyNotFound"}, true},
+		{&StorageError{StatusCode: http.StatusBadRequest, Code: "InvalidEncryptionScope"}, true},
+		{&StorageError{StatusCode: http.StatusForbidden, Code: "AuthorizationPermissionMismatch"}, false},
+		{&StorageError{StatusCode: http.StatusNotFound, Code: "ContainerNotFound"}, false},
+		{&StorageError{StatusCode: http.StatusInternalServerError, Code: "InternalError"}, false},
+		{context.DeadlineExceeded, false},
+	} {
+		if got := encryptionRefused(test.err); got != test.want {
+			t.Errorf("encryptionRefused(%v) = %t, want %t", test.err, got, test.want)
+		}
+	}
+}
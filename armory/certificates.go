@@ -0,0 +1,178 @@
+package armory
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const defaultExpiryWarningDays = 30
+
+// CertificatePolicy holds the thresholds applied to presented certificate chains
+type CertificatePolicy struct {
+	ExpiryWarning       time.Duration // Certificates expiring sooner than this fail the check
+	RequireOCSPStapling bool
+	MinimumRSABits      int
+	MinimumECDSABits    int
+	Roots               *x509.CertPool // Trust anchors for chain verification, nil for the system pool
+}
+
+// LoadCertificatePolicy reads raids.ABS.certificates
+func LoadCertificatePolicy() CertificatePolicy {
+	days := defaultExpiryWarningDays
+	if viper.IsSet("raids.ABS.certificates.expiry_warning_days") {
+		days = viper.GetInt("raids.ABS.certificates.expiry_warning_days")
+	}
+	return CertificatePolicy{
+		ExpiryWarning:       time.Duration(days) * 24 * time.Hour,
+		RequireOCSPStapling: viper.GetBool("raids.ABS.certificates.require_ocsp_stapling"),
+		MinimumRSABits:      2048,
+		MinimumECDSABits:    256,
+	}
+}
+
+// CertificateReport describes the chain presented by one endpoint
+type CertificateReport struct {
+	Endpoint     string
+	Fingerprints []string // SHA-256 of each certificate, leaf first
+	LeafExpiry   time.Time
+	OCSPStapled  bool
+	Issues       []string
+}
+
+// FetchTLSState completes a handshake with endpoint and returns the resulting TLS state.
+// The handshake skips verification so that an untrusted or expired chain can still be inspected
+// and reported; InspectCertificates verifies the chain explicitly.
+func FetchTLSState(dial DialFunc, endpoint string) (*tls.ConnectionState, error) {
+	host, address, err := endpointAddress(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	rawConnection, err := dial(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect: %v", err)
+	}
+	connection := tls.Client(rawConnection, &tls.Config{
+		ServerName:         host,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true, // The chain is verified by InspectCertificates so that failures carry evidence
+	})
+	defer connection.Close()
+	if err := connection.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("handshake failed: %v", err)
+	}
+	state := connection.ConnectionState()
+	return &state, nil
+}
+
+// InspectCertificates checks the chain in state against policy for the host in endpoint
+func InspectCertificates(endpoint string, state *tls.ConnectionState, policy CertificatePolicy) CertificateReport {
+	report := CertificateReport{Endpoint: endpoint, OCSPStapled: len(state.OCSPResponse) > 0}
+	chain := state.PeerCertificates
+	if len(chain) == 0 {
+		report.Issues = append(report.Issues, "no certificates were presented")
+		return report
+	}
+	leaf := chain[0]
+	report.LeafExpiry = leaf.NotAfter
+
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		report.Issues = append(report.Issues, err.Error())
+		return report
+	}
+	if err := leaf.VerifyHostname(parsed.Hostname()); err != nil {
+		report.Issues = append(report.Issues, fmt.Sprintf("SANs do not cover %s", parsed.Hostname()))
+	}
+	if issue := chainIssue(chain, policy.Roots); issue != "" {
+		report.Issues = append(report.Issues, issue)
+	}
+
+	now := time.Now()
+	for i, certificate := range chain {
+		fingerprint := sha256.Sum256(certificate.Raw)
+		report.Fingerprints = append(report.Fingerprints, hex.EncodeToString(fingerprint[:]))
+		subject := certificate.Subject.CommonName
+
+		switch {
+		case now.Before(certificate.NotBefore):
+			report.Issues = append(report.Issues, fmt.Sprintf("%s is not valid until %s", subject, certificate.NotBefore.Format(time.RFC3339)))
+		case now.After(certificate.NotAfter):
+			report.Issues = append(report.Issues, fmt.Sprintf("%s expired on %s", subject, certificate.NotAfter.Format(time.RFC3339)))
+		case certificate.NotAfter.Sub(now) < policy.ExpiryWarning:
+			report.Issues = append(report.Issues, fmt.Sprintf("%s expires on %s, within the %d day warning window",
+				subject, certificate.NotAfter.Format(time.RFC3339), int(policy.ExpiryWarning.Hours()/24)))
+		}
+
+		if issue := keySizeIssue(certificate, policy); issue != "" {
+			report.Issues = append(report.Issues, fmt.Sprintf("%s %s", subject, issue))
+		}
+		// a self-signed root is trusted by presence in the store, so its own signature is irrelevant
+		selfSigned := i > 0 && certificate.CheckSignatureFrom(certificate) == nil
+		if weakSignatureAlgorithm(certificate.SignatureAlgorithm) && !selfSigned {
+			report.Issues = append(report.Issues, fmt.Sprintf("%s is signed with %s", subject, certificate.SignatureAlgorithm))
+		}
+	}
+
+	if policy.RequireOCSPStapling && !report.OCSPStapled {
+		report.Issues = append(report.Issues, "no OCSP response was stapled")
+	}
+	return report
+}
+
+// chainIssue verifies chain against roots and describes why it does not verify.
+// Validity periods and hostnames are reported per certificate by InspectCertificates, so those failures are left to it.
+func chainIssue(chain []*x509.Certificate, roots *x509.CertPool) string {
+	intermediates := x509.NewCertPool()
+	for _, certificate := range chain[1:] {
+		intermediates.AddCert(certificate)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	if err == nil {
+		return ""
+	}
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &invalid) && invalid.Reason == x509.Expired {
+		return ""
+	}
+	var unknown x509.UnknownAuthorityError
+	if errors.As(err, &unknown) {
+		issuer := chain[len(chain)-1].Issuer.String()
+		return fmt.Sprintf("chain does not lead to a trusted root (last issuer %s)", issuer)
+	}
+	return fmt.Sprintf("chain does not verify: %v", err)
+}
+
+func keySizeIssue(certificate *x509.Certificate, policy CertificatePolicy) string {
+	switch key := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < policy.MinimumRSABits {
+			return fmt.Sprintf("has a %d-bit RSA key", key.N.BitLen())
+		}
+	case *ecdsa.PublicKey:
+		if key.Curve.Params().BitSize < policy.MinimumECDSABits {
+			return fmt.Sprintf("has a %d-bit ECDSA key", key.Curve.Params().BitSize)
+		}
+	}
+	return ""
+}
+
+func weakSignatureAlgorithm(algorithm x509.SignatureAlgorithm) bool {
+	switch algorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		return true
+	}
+	return false
+}
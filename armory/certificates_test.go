@@ -0,0 +1,30 @@
+package armory
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+)
+
+func TestInspectCertificatesVerifiesChain(t *testing.T) {
+	server := newTLSServer(t, nil)
+	state, err := FetchTLSState(directDial, server.URL)
+	if err != nil {
+		t.Fatalf("an untrusted chain should still be fetched for inspection: %v", err)
+	}
+
+	policy := CertificatePolicy{MinimumRSABits: 2048, MinimumECDSABits: 256, Roots: x509.NewCertPool()}
+	report := InspectCertificates(server.URL, state, policy)
+	if len(report.Fingerprints) == 0 || report.LeafExpiry.IsZero() {
+		t.Errorf("report is missing evidence: %+v", report)
+	}
+	if !strings.Contains(strings.Join(report.Issues, "; "), "trusted root") {
+		t.Errorf("an unknown issuer was not reported: %v", report.Issues)
+	}
+
+	policy.Roots.AddCert(server.Certificate())
+	report = InspectCertificates(server.URL, state, policy)
+	if len(report.Issues) != 0 {
+		t.Errorf("a chain to a trusted root reported %v", report.Issues)
+	}
+}
@@ -0,0 +1,626 @@
+package armory
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Supported values for raids.ABS.auth.method
+const (
+	AuthMethodChain             = "chain"
+	AuthMethodClientSecret      = "client_secret"
+	AuthMethodClientCertificate = "client_certificate"
+	AuthMethodManagedIdentity   = "managed_identity"
+	AuthMethodWorkloadIdentity  = "workload_identity"
+	AuthMethodAzureCLI          = "azure_cli"
+)
+
+const (
+	defaultAuthorityHost           = "https://login.microsoftonline.com"
+	defaultManagedIdentityEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+	// tokens are refreshed this long before they expire
+	tokenRefreshWindow = 5 * time.Minute
+)
+
+// AccessToken is a bearer token issued for a single scope
+type AccessToken struct {
+	Token     string
+	ExpiresOn time.Time
+}
+
+// TokenCredential is implemented by every supported way of authenticating to Azure
+type TokenCredential interface {
+	GetToken(ctx context.Context, scope string) (AccessToken, error)
+}
+
+// CredentialConfig holds the values read from raids.ABS.auth, with the standard AZURE_* environment variables as fallbacks
+type CredentialConfig struct {
+	Method                  string
+	TenantID                string
+	ClientID                string
+	ClientSecret            string
+	CertificatePath         string
+	FederatedTokenFile      string
+	AuthorityHost           string
+	ManagedIdentityEndpoint string
+	AzureConfigDir          string
+}
+
+// LoadCredentialConfig reads the credential settings from the raid config
+func LoadCredentialConfig() CredentialConfig {
+	return CredentialConfig{
+		Method:                  strings.ToLower(viper.GetString("raids.ABS.auth.method")),
+		TenantID:                configOrEnv("raids.ABS.auth.tenant_id", "AZURE_TENANT_ID"),
+		ClientID:                configOrEnv("raids.ABS.auth.client_id", "AZURE_CLIENT_ID"),
+		ClientSecret:            configOrEnv("raids.ABS.auth.client_secret", "AZURE_CLIENT_SECRET"),
+		CertificatePath:         configOrEnv("raids.ABS.auth.certificate_path", "AZURE_CLIENT_CERTIFICATE_PATH"),
+		FederatedTokenFile:      configOrEnv("raids.ABS.auth.federated_token_file", "AZURE_FEDERATED_TOKEN_FILE"),
+		AuthorityHost:           configOrEnv("raids.ABS.auth.authority_host", "AZURE_AUTHORITY_HOST"),
+		ManagedIdentityEndpoint: configOrEnv("raids.ABS.auth.managed_identity_endpoint", "IDENTITY_ENDPOINT"),
+		AzureConfigDir:          configOrEnv("raids.ABS.auth.azure_config_dir", "AZURE_CONFIG_DIR"),
+	}
+}
+
+func configOrEnv(key, env string) string {
+	if value := viper.GetString(key); value != "" {
+		return value
+	}
+	return os.Getenv(env)
+}
+
+// NewCredential builds the credential selected by config.Method.
+// An empty method, or "chain", tries every credential that has enough configuration to be attempted.
+func NewCredential(config CredentialConfig, client *http.Client) (TokenCredential, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if config.AuthorityHost == "" {
+		config.AuthorityHost = defaultAuthorityHost
+	}
+	config.AuthorityHost = strings.TrimSuffix(config.AuthorityHost, "/")
+
+	var credential TokenCredential
+	var err error
+	switch config.Method {
+	case "", AuthMethodChain:
+		credential, err = newChainCredential(config, client)
+	case AuthMethodClientSecret:
+		credential, err = newClientSecretCredential(config, client)
+	case AuthMethodClientCertificate:
+		credential, err = newClientCertificateCredential(config, client)
+	case AuthMethodManagedIdentity:
+		credential, err = newManagedIdentityCredential(config, client)
+	case AuthMethodWorkloadIdentity:
+		credential, err = newWorkloadIdentityCredential(config, client)
+	case AuthMethodAzureCLI:
+		credential, err = newAzureCLICredential(config)
+	default:
+		err = fmt.Errorf("unsupported auth method %q", config.Method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cachedCredential{source: credential, tokens: make(map[string]AccessToken)}, nil
+}
+
+// -----
+// Token caching
+// -----
+
+// cachedCredential reuses tokens per scope until they are close to expiry
+type cachedCredential struct {
+	source TokenCredential
+	mutex  sync.Mutex
+	tokens map[string]AccessToken
+}
+
+func (c *cachedCredential) GetToken(ctx context.Context, scope string) (AccessToken, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if token, ok := c.tokens[scope]; ok && time.Until(token.ExpiresOn) > tokenRefreshWindow {
+		return token, nil
+	}
+	token, err := c.source.GetToken(ctx, scope)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	c.tokens[scope] = token
+	return token, nil
+}
+
+// -----
+// Credential chain
+// -----
+
+type namedCredential struct {
+	name       string
+	credential TokenCredential
+}
+
+// chainCredential returns the first token any of its credentials can produce
+type chainCredential struct {
+	credentials []namedCredential
+	mutex       sync.Mutex
+	selected    *namedCredential
+}
+
+func newChainCredential(config CredentialConfig, client *http.Client) (TokenCredential, error) {
+	chain := &chainCredential{}
+	var failures []string
+	add := func(name string, credential TokenCredential, err error) {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		chain.credentials = append(chain.credentials, namedCredential{name: name, credential: credential})
+	}
+
+	if config.ClientSecret != "" {
+		credential, err := newClientSecretCredential(config, client)
+		add(AuthMethodClientSecret, credential, err)
+	}
+	if config.CertificatePath != "" {
+		credential, err := newClientCertificateCredential(config, client)
+		add(AuthMethodClientCertificate, credential, err)
+	}
+	if config.FederatedTokenFile != "" {
+		credential, err := newWorkloadIdentityCredential(config, client)
+		add(AuthMethodWorkloadIdentity, credential, err)
+	}
+	credential, err := newManagedIdentityCredential(config, client)
+	add(AuthMethodManagedIdentity, credential, err)
+	// the CLI is only a fallback, so a missing home directory is not worth failing the chain over
+	if credential, err := newAzureCLICredential(config); err == nil {
+		add(AuthMethodAzureCLI, credential, nil)
+	}
+
+	// a credential that was configured but cannot be built is a mistake, not a reason to fall through to the next one
+	if len(failures) > 0 {
+		return nil, fmt.Errorf("unable to build the credential chain: %s", strings.Join(failures, "; "))
+	}
+	return chain, nil
+}
+
+func (c *chainCredential) GetToken(ctx context.Context, scope string) (AccessToken, error) {
+	c.mutex.Lock()
+	selected := c.selected
+	c.mutex.Unlock()
+	if selected != nil {
+		return selected.credential.GetToken(ctx, scope)
+	}
+
+	var failures []string
+	for i := range c.credentials {
+		candidate := &c.credentials[i]
+		token, err := candidate.credential.GetToken(ctx, scope)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", candidate.name, err))
+			continue
+		}
+		c.mutex.Lock()
+		c.selected = candidate
+		c.mutex.Unlock()
+		return token, nil
+	}
+	return AccessToken{}, fmt.Errorf("no credential in the chain could authenticate: %s", strings.Join(failures, "; "))
+}
+
+// -----
+// Microsoft identity platform (client credentials flow)
+// -----
+
+type tokenResponse struct {
+	AccessToken      string      `json:"access_token"`
+	ExpiresIn        json.Number `json:"expires_in"`
+	ExpiresOn        json.Number `json:"expires_on"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+// toAccessToken converts the token endpoint response, which reports expiry either relative or absolute
+func (t tokenResponse) toAccessToken() (AccessToken, error) {
+	if t.AccessToken == "" {
+		return AccessToken{}, errors.New("token response did not contain an access token")
+	}
+	token := AccessToken{Token: t.AccessToken}
+	if seconds, err := t.ExpiresOn.Int64(); err == nil && seconds > 0 {
+		token.ExpiresOn = time.Unix(seconds, 0)
+	} else if seconds, err := t.ExpiresIn.Int64(); err == nil && seconds > 0 {
+		token.ExpiresOn = time.Now().Add(time.Duration(seconds) * time.Second)
+	} else {
+		token.ExpiresOn = time.Now().Add(time.Hour)
+	}
+	return token, nil
+}
+
+func decodeTokenResponse(response *http.Response) (AccessToken, error) {
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return AccessToken{}, err
+	}
+
+	var parsed tokenResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return AccessToken{}, fmt.Errorf("unable to parse token response (HTTP %d): %v", response.StatusCode, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		if parsed.Error != "" {
+			return AccessToken{}, fmt.Errorf("token request failed (HTTP %d): %s: %s", response.StatusCode, parsed.Error, parsed.ErrorDescription)
+		}
+		return AccessToken{}, fmt.Errorf("token request failed with HTTP %d", response.StatusCode)
+	}
+	return parsed.toAccessToken()
+}
+
+// identityPlatformCredential requests tokens from the tenant's v2.0 token endpoint
+type identityPlatformCredential struct {
+	client        *http.Client
+	tokenEndpoint string
+	clientID      string
+	// credentialForm returns the form fields that prove the client's identity
+	credentialForm func() (url.Values, error)
+}
+
+func newIdentityPlatformCredential(config CredentialConfig, client *http.Client) (*identityPlatformCredential, error) {
+	if config.TenantID == "" {
+		return nil, errors.New("tenant_id is required")
+	}
+	if config.ClientID == "" {
+		return nil, errors.New("client_id is required")
+	}
+	return &identityPlatformCredential{
+		client:        client,
+		tokenEndpoint: fmt.Sprintf("%s/%s/oauth2/v2.0/token", config.AuthorityHost, url.PathEscape(config.TenantID)),
+		clientID:      config.ClientID,
+	}, nil
+}
+
+func (c *identityPlatformCredential) GetToken(ctx context.Context, scope string) (AccessToken, error) {
+	form, err := c.credentialForm()
+	if err != nil {
+		return AccessToken{}, err
+	}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", c.clientID)
+	form.Set("scope", scope)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return AccessToken{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	return decodeTokenResponse(response)
+}
+
+func newClientSecretCredential(config CredentialConfig, client *http.Client) (TokenCredential, error) {
+	if config.ClientSecret == "" {
+		return nil, errors.New("client_secret is required")
+	}
+	credential, err := newIdentityPlatformCredential(config, client)
+	if err != nil {
+		return nil, err
+	}
+	credential.credentialForm = func() (url.Values, error) {
+		return url.Values{"client_secret": {config.ClientSecret}}, nil
+	}
+	return credential, nil
+}
+
+func newClientCertificateCredential(config CredentialConfig, client *http.Client) (TokenCredential, error) {
+	if config.CertificatePath == "" {
+		return nil, errors.New("certificate_path is required")
+	}
+	certificate, key, err := loadCertificateAndKey(config.CertificatePath)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := newIdentityPlatformCredential(config, client)
+	if err != nil {
+		return nil, err
+	}
+	credential.credentialForm = func() (url.Values, error) {
+		assertion, err := signClientAssertion(credential.clientID, credential.tokenEndpoint, certificate, key)
+		if err != nil {
+			return nil, err
+		}
+		return clientAssertionForm(assertion), nil
+	}
+	return credential, nil
+}
+
+func newWorkloadIdentityCredential(config CredentialConfig, client *http.Client) (TokenCredential, error) {
+	if config.FederatedTokenFile == "" {
+		return nil, errors.New("federated_token_file is required")
+	}
+	credential, err := newIdentityPlatformCredential(config, client)
+	if err != nil {
+		return nil, err
+	}
+	credential.credentialForm = func() (url.Values, error) {
+		// the file is re-read on every request because the issuer rotates it in place
+		assertion, err := os.ReadFile(config.FederatedTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read federated token file: %v", err)
+		}
+		return clientAssertionForm(strings.TrimSpace(string(assertion))), nil
+	}
+	return credential, nil
+}
+
+func clientAssertionForm(assertion string) url.Values {
+	return url.Values{
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {assertion},
+	}
+}
+
+// loadCertificateAndKey reads a PEM file containing the client certificate and its unencrypted RSA private key
+func loadCertificateAndKey(path string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read certificate: %v", err)
+	}
+
+	var certificate *x509.Certificate
+	var key *rsa.PrivateKey
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "CERTIFICATE":
+			if certificate == nil {
+				certificate, err = x509.ParseCertificate(block.Bytes)
+			}
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			var parsed interface{}
+			parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+			if rsaKey, ok := parsed.(*rsa.PrivateKey); ok {
+				key = rsaKey
+			} else if err == nil {
+				err = errors.New("only RSA private keys are supported")
+			}
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to parse %s: %v", path, err)
+		}
+	}
+	if certificate == nil || key == nil {
+		return nil, nil, fmt.Errorf("%s must contain a PEM certificate and private key", path)
+	}
+	return certificate, key, nil
+}
+
+// signClientAssertion builds the RS256 JWT that proves possession of the certificate's private key
+func signClientAssertion(clientID, audience string, certificate *x509.Certificate, key *rsa.PrivateKey) (string, error) {
+	thumbprint := sha1.Sum(certificate.Raw)
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": audience,
+		"iss": clientID,
+		"sub": clientID,
+		"jti": hex.EncodeToString(jti),
+		"nbf": now.Unix(),
+		"exp": now.Add(10 * time.Minute).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// -----
+// Managed identity
+// -----
+
+// managedIdentityCredential uses IMDS, or the App Service identity endpoint when IDENTITY_HEADER is present
+type managedIdentityCredential struct {
+	client         *http.Client
+	endpoint       string
+	clientID       string
+	identityHeader string
+}
+
+func newManagedIdentityCredential(config CredentialConfig, client *http.Client) (TokenCredential, error) {
+	endpoint := config.ManagedIdentityEndpoint
+	if endpoint == "" {
+		endpoint = defaultManagedIdentityEndpoint
+	}
+	// IMDS is a link-local endpoint that never answers off-Azure, so fail fast instead of using the client timeout
+	imdsClient := *client
+	if imdsClient.Timeout == 0 || imdsClient.Timeout > 5*time.Second {
+		imdsClient.Timeout = 5 * time.Second
+	}
+	return &managedIdentityCredential{
+		client:         &imdsClient,
+		endpoint:       endpoint,
+		clientID:       config.ClientID,
+		identityHeader: os.Getenv("IDENTITY_HEADER"),
+	}, nil
+}
+
+func (c *managedIdentityCredential) GetToken(ctx context.Context, scope string) (AccessToken, error) {
+	query := url.Values{"resource": {strings.TrimSuffix(scope, "/.default")}}
+	if c.clientID != "" {
+		query.Set("client_id", c.clientID)
+	}
+	if c.identityHeader != "" {
+		query.Set("api-version", "2019-08-01")
+	} else {
+		query.Set("api-version", "2018-02-01")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	if c.identityHeader != "" {
+		request.Header.Set("X-IDENTITY-HEADER", c.identityHeader)
+	} else {
+		request.Header.Set("Metadata", "true")
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return AccessToken{}, fmt.Errorf("managed identity endpoint unavailable: %v", err)
+	}
+	return decodeTokenResponse(response)
+}
+
+// -----
+// Azure CLI
+// -----
+
+// azureCLICredential reads tokens from the Azure CLI's MSAL token cache, falling back to `az account get-access-token`
+type azureCLICredential struct {
+	configDir string
+	tenantID  string
+}
+
+func newAzureCLICredential(config CredentialConfig) (TokenCredential, error) {
+	configDir := config.AzureConfigDir
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		configDir = filepath.Join(home, ".azure")
+	}
+	return &azureCLICredential{configDir: configDir, tenantID: config.TenantID}, nil
+}
+
+type msalTokenCache struct {
+	AccessToken map[string]struct {
+		Secret    string `json:"secret"`
+		Target    string `json:"target"`
+		Realm     string `json:"realm"`
+		ExpiresOn string `json:"expires_on"`
+	} `json:"AccessToken"`
+}
+
+func (c *azureCLICredential) GetToken(ctx context.Context, scope string) (AccessToken, error) {
+	if token, err := c.tokenFromCache(scope); err == nil {
+		return token, nil
+	}
+	return c.tokenFromCLI(ctx, scope)
+}
+
+func (c *azureCLICredential) tokenFromCache(scope string) (AccessToken, error) {
+	data, err := os.ReadFile(filepath.Join(c.configDir, "msal_token_cache.json"))
+	if err != nil {
+		return AccessToken{}, err
+	}
+	var cache msalTokenCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return AccessToken{}, err
+	}
+
+	resource := strings.TrimSuffix(scope, "/.default")
+	var best AccessToken
+	for _, entry := range cache.AccessToken {
+		if c.tenantID != "" && !strings.EqualFold(entry.Realm, c.tenantID) {
+			continue
+		}
+		if !strings.Contains(entry.Target, resource) {
+			continue
+		}
+		seconds, err := strconv.ParseInt(entry.ExpiresOn, 10, 64)
+		if err != nil {
+			continue
+		}
+		expiresOn := time.Unix(seconds, 0)
+		if time.Until(expiresOn) > tokenRefreshWindow && expiresOn.After(best.ExpiresOn) {
+			best = AccessToken{Token: entry.Secret, ExpiresOn: expiresOn}
+		}
+	}
+	if best.Token == "" {
+		return AccessToken{}, fmt.Errorf("no unexpired token for %s in the Azure CLI cache", resource)
+	}
+	return best, nil
+}
+
+func (c *azureCLICredential) tokenFromCLI(ctx context.Context, scope string) (AccessToken, error) {
+	args := []string{"account", "get-access-token", "--output", "json", "--scope", scope}
+	if c.tenantID != "" {
+		args = append(args, "--tenant", c.tenantID)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	command := exec.CommandContext(ctx, "az", args...)
+	command.Env = append(os.Environ(), "AZURE_CONFIG_DIR="+c.configDir)
+	output, err := command.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return AccessToken{}, fmt.Errorf("az account get-access-token failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return AccessToken{}, fmt.Errorf("unable to run the Azure CLI: %v", err)
+	}
+
+	var parsed struct {
+		AccessToken string `json:"accessToken"`
+		ExpiresOn   int64  `json:"expires_on"`
+	}
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return AccessToken{}, fmt.Errorf("unable to parse Azure CLI output: %v", err)
+	}
+	if parsed.AccessToken == "" {
+		return AccessToken{}, errors.New("Azure CLI did not return an access token")
+	}
+	token := AccessToken{Token: parsed.AccessToken, ExpiresOn: time.Unix(parsed.ExpiresOn, 0)}
+	if parsed.ExpiresOn == 0 {
+		// older CLI versions only report a local timestamp, so assume the default token lifetime
+		token.ExpiresOn = time.Now().Add(time.Hour)
+	}
+	return token, nil
+}
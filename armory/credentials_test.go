@@ -0,0 +1,250 @@
+package armory
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testScope = "https://management.azure.com/.default"
+
+// fakeTokenEndpoint serves the identity platform and managed identity token endpoints and records every request
+type fakeTokenEndpoint struct {
+	*httptest.Server
+	mutex     sync.Mutex
+	requests  []*http.Request
+	forms     []url.Values
+	expiresIn int
+}
+
+func newFakeTokenEndpoint(t *testing.T) *fakeTokenEndpoint {
+	fake := &fakeTokenEndpoint{expiresIn: 3600}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("unable to parse token request: %v", err)
+		}
+		fake.mutex.Lock()
+		fake.requests = append(fake.requests, r)
+		fake.forms = append(fake.forms, r.PostForm)
+		count, expiresIn := len(fake.requests), fake.expiresIn
+		fake.mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":%d}`, count, expiresIn)
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+func (f *fakeTokenEndpoint) count() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.requests)
+}
+
+func (f *fakeTokenEndpoint) config() CredentialConfig {
+	return CredentialConfig{TenantID: "tenant", ClientID: "client", AuthorityHost: f.URL}
+}
+
+func TestClientSecretCredential(t *testing.T) {
+	endpoint := newFakeTokenEndpoint(t)
+	config := endpoint.config()
+	config.Method = AuthMethodClientSecret
+	config.ClientSecret = "secret"
+
+	credential, err := NewCredential(config, endpoint.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := credential.GetToken(context.Background(), testScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Token != "token-1" {
+		t.Errorf("got token %q", token.Token)
+	}
+
+	request, form := endpoint.requests[0], endpoint.forms[0]
+	if request.URL.Path != "/tenant/oauth2/v2.0/token" {
+		t.Errorf("token requested from %s", request.URL.Path)
+	}
+	for field, want := range map[string]string{"grant_type": "client_credentials", "client_id": "client", "client_secret": "secret", "scope": testScope} {
+		if got := form.Get(field); got != want {
+			t.Errorf("%s = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestClientCertificateCredential(t *testing.T) {
+	endpoint := newFakeTokenEndpoint(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "privateer-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "client.pem")
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})...)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := endpoint.config()
+	config.Method = AuthMethodClientCertificate
+	config.CertificatePath = path
+	credential, err := NewCredential(config, endpoint.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := credential.GetToken(context.Background(), testScope); err != nil {
+		t.Fatal(err)
+	}
+
+	form := endpoint.forms[0]
+	if form.Get("client_assertion_type") != "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" {
+		t.Errorf("client_assertion_type = %q", form.Get("client_assertion_type"))
+	}
+	parts := strings.Split(form.Get("client_assertion"), ".")
+	if len(parts) != 3 {
+		t.Fatalf("client assertion is not a JWT: %q", form.Get("client_assertion"))
+	}
+	var claims struct {
+		Audience string `json:"aud"`
+		Issuer   string `json:"iss"`
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Audience != endpoint.URL+"/tenant/oauth2/v2.0/token" || claims.Issuer != "client" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("assertion signature does not verify: %v", err)
+	}
+}
+
+func TestManagedIdentityCredential(t *testing.T) {
+	t.Setenv("IDENTITY_HEADER", "")
+	endpoint := newFakeTokenEndpoint(t)
+	config := CredentialConfig{Method: AuthMethodManagedIdentity, ClientID: "user-assigned", ManagedIdentityEndpoint: endpoint.URL + "/metadata/identity/oauth2/token"}
+
+	credential, err := NewCredential(config, endpoint.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := credential.GetToken(context.Background(), testScope); err != nil {
+		t.Fatal(err)
+	}
+
+	request := endpoint.requests[0]
+	if request.Header.Get("Metadata") != "true" {
+		t.Error("IMDS request is missing the Metadata header")
+	}
+	query := request.URL.Query()
+	if query.Get("resource") != "https://management.azure.com" || query.Get("client_id") != "user-assigned" {
+		t.Errorf("unexpected query %s", request.URL.RawQuery)
+	}
+}
+
+func TestWorkloadIdentityCredential(t *testing.T) {
+	endpoint := newFakeTokenEndpoint(t)
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("federated-1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := endpoint.config()
+	config.Method = AuthMethodWorkloadIdentity
+	config.FederatedTokenFile = path
+
+	credential, err := NewCredential(config, endpoint.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := credential.GetToken(context.Background(), testScope); err != nil {
+		t.Fatal(err)
+	}
+	// the issuer rotates the file in place, so a fresh token request must send the new assertion
+	if err := os.WriteFile(path, []byte("federated-2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := credential.GetToken(context.Background(), "https://storage.azure.com/.default"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []string{"federated-1", "federated-2"} {
+		if got := endpoint.forms[i].Get("client_assertion"); got != want {
+			t.Errorf("request %d sent assertion %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestCachedCredentialExpiry(t *testing.T) {
+	endpoint := newFakeTokenEndpoint(t)
+	config := endpoint.config()
+	config.Method = AuthMethodClientSecret
+	config.ClientSecret = "secret"
+	credential, err := NewCredential(config, endpoint.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := credential.GetToken(context.Background(), testScope); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if endpoint.count() != 1 {
+		t.Errorf("long-lived token was requested %d times, want 1", endpoint.count())
+	}
+
+	// tokens inside the refresh window are fetched again on every call
+	endpoint.mutex.Lock()
+	endpoint.expiresIn = int(tokenRefreshWindow/time.Second) - 60
+	endpoint.mutex.Unlock()
+	scope := "https://storage.azure.com/.default"
+	for i := 0; i < 2; i++ {
+		if _, err := credential.GetToken(context.Background(), scope); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if endpoint.count() != 3 {
+		t.Errorf("token endpoint was called %d times, want 3", endpoint.count())
+	}
+}
+
+func TestChainCredentialReportsConstructionErrors(t *testing.T) {
+	config := CredentialConfig{TenantID: "tenant", ClientID: "client", CertificatePath: filepath.Join(t.TempDir(), "missing.pem")}
+	if _, err := NewCredential(config, nil); err == nil || !strings.Contains(err.Error(), AuthMethodClientCertificate) {
+		t.Errorf("expected the unreadable certificate to fail the chain, got %v", err)
+	}
+}
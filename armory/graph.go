@@ -0,0 +1,487 @@
+package armory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Application IDs of the first-party resources whose sign-ins Conditional Access must cover
+const (
+	AzureResourceManagerAppID = "797f4846-ba00-4fd7-ba43-dac1f8f63013" // Windows Azure Service Management API
+	AzureStorageAppID         = "e406a681-f3d4-42a8-90b6-c2b029497af1"
+)
+
+// PrivilegedRoles maps the template IDs of built-in Entra ID administrator roles to their display names.
+// It is used for CCC_C03_TR02 unless raids.ABS.mfa.privileged_roles lists other role template IDs.
+var PrivilegedRoles = map[string]string{
+	"62e90394-69f5-4237-9190-012177145e10": "Global Administrator",
+	"e8611ab8-c189-46e8-94e1-60213ab1f814": "Privileged Role Administrator",
+	"7be44c8a-adaf-4e2a-84d6-ab2649e08a13": "Privileged Authentication Administrator",
+	"194ae4cb-b126-40b2-bd5b-6091b380977d": "Security Administrator",
+	"b1be1c3e-b65d-4f19-8427-f6fa0d97feb9": "Conditional Access Administrator",
+	"fe930be7-5e62-47db-91af-98c3a49a38b1": "User Administrator",
+	"c4e39bd9-1100-46d3-8c65-fb160da0071f": "Authentication Administrator",
+	"9b895d92-2cd3-44c7-9d02-a6ac2d5ea5c3": "Application Administrator",
+	"158c047a-c907-4556-b7ef-446551a6b5f7": "Cloud Application Administrator",
+	"729827e3-9c14-49f7-bb1b-9608f156bbb8": "Helpdesk Administrator",
+	"f28a1f50-f6e7-4571-818b-6a12f2af6b6c": "SharePoint Administrator",
+	"29232cdf-9323-42fd-ade2-1d097af3e4de": "Exchange Administrator",
+	"b0f54661-2d74-4c50-afa3-1ec803f12efe": "Billing Administrator",
+}
+
+// GraphError is returned when Microsoft Graph responds with a non-success status
+type GraphError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *GraphError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("Graph request failed with HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("Graph request failed with HTTP %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// GraphClient makes authenticated requests to the Microsoft Graph REST API
+type GraphClient struct {
+	Endpoint   string
+	Scope      string
+	Credential TokenCredential
+	HTTPClient *http.Client
+}
+
+// NewGraphClient creates a client for the Microsoft Graph endpoint of cloud
+func NewGraphClient(cloud CloudEnvironment, credential TokenCredential, client *http.Client) *GraphClient {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &GraphClient{
+		Endpoint:   strings.TrimSuffix(cloud.GraphEndpoint, "/"),
+		Scope:      cloud.GraphScope,
+		Credential: credential,
+		HTTPClient: client,
+	}
+}
+
+// List reads every page of the collection at path, calling each for every item
+func (c *GraphClient) List(ctx context.Context, path string, each func(item json.RawMessage) error) error {
+	next := c.Endpoint + path
+	for next != "" {
+		var page struct {
+			Value    []json.RawMessage `json:"value"`
+			NextLink string            `json:"@odata.nextLink"`
+		}
+		if err := c.Do(ctx, http.MethodGet, next, nil, &page); err != nil {
+			return err
+		}
+		for _, item := range page.Value {
+			if err := each(item); err != nil {
+				return err
+			}
+		}
+		next = page.NextLink
+	}
+	return nil
+}
+
+// Do sends body as JSON to the absolute requestURL and decodes the response into out
+func (c *GraphClient) Do(ctx context.Context, method, requestURL string, body, out interface{}) error {
+	token, err := c.Credential.GetToken(ctx, c.Scope)
+	if err != nil {
+		return fmt.Errorf("unable to authenticate to Microsoft Graph: %v", err)
+	}
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, requestURL, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token.Token)
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		graphErr := &GraphError{StatusCode: response.StatusCode}
+		var parsed struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &parsed) == nil {
+			graphErr.Code = parsed.Error.Code
+			graphErr.Message = parsed.Error.Message
+		}
+		return graphErr
+	}
+	return json.Unmarshal(data, out)
+}
+
+// DirectoryObject is a user, group or service principal returned by Microsoft Graph
+type DirectoryObject struct {
+	Type                   string `json:"@odata.type"` // For example #microsoft.graph.user
+	ID                     string `json:"id"`
+	DisplayName            string `json:"displayName"`
+	UserType               string `json:"userType"`               // Member or Guest, for users
+	AppOwnerOrganizationID string `json:"appOwnerOrganizationId"` // Tenant that registered the application, for service principals
+	ServicePrincipalType   string `json:"servicePrincipalType"`   // Application or ManagedIdentity, for service principals
+	UserPrincipalName      string `json:"userPrincipalName"`      // Carries #EXT# for guests invited from another directory
+}
+
+// GuestUser is the subset of a Graph user read to work out where a guest signs in from
+type GuestUser struct {
+	ID                string          `json:"id"`
+	DisplayName       string          `json:"displayName"`
+	UserType          string          `json:"userType"`
+	Mail              string          `json:"mail"`
+	UserPrincipalName string          `json:"userPrincipalName"`
+	Identities        []GuestIdentity `json:"identities"`
+}
+
+// GuestIdentity is one of the ways a user can sign in
+type GuestIdentity struct {
+	SignInType string `json:"signInType"`
+	Issuer     string `json:"issuer"` // ExternalAzureAD, MicrosoftAccount, mail or the federated domain
+}
+
+// HomeDomain returns the domain of the directory or identity provider the guest signs in with
+func (u *GuestUser) HomeDomain() string {
+	for _, identity := range u.Identities {
+		if strings.Contains(identity.Issuer, ".") && !strings.EqualFold(identity.Issuer, u.tenantIssuer()) {
+			return strings.ToLower(identity.Issuer)
+		}
+	}
+	if at := strings.LastIndex(u.Mail, "@"); at >= 0 {
+		return strings.ToLower(u.Mail[at+1:])
+	}
+	// invited guests are named alias_domain#EXT#@host
+	if ext := strings.Index(strings.ToUpper(u.UserPrincipalName), "#EXT#"); ext > 0 {
+		local := u.UserPrincipalName[:ext]
+		if underscore := strings.LastIndex(local, "_"); underscore >= 0 {
+			return strings.ToLower(local[underscore+1:])
+		}
+	}
+	return ""
+}
+
+// PersonalAccount reports whether the guest signs in with a Microsoft account rather than a work or school directory
+func (u *GuestUser) PersonalAccount() bool {
+	for _, identity := range u.Identities {
+		if strings.EqualFold(identity.Issuer, "MicrosoftAccount") {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantIssuer is the issuer recorded for identities created in the home directory itself
+func (u *GuestUser) tenantIssuer() string {
+	if at := strings.LastIndex(u.UserPrincipalName, "@"); at >= 0 {
+		return u.UserPrincipalName[at+1:]
+	}
+	return ""
+}
+
+// GetGuestUser reads the properties that identify where the user with id signs in from
+func (c *GraphClient) GetGuestUser(ctx context.Context, id string) (*GuestUser, error) {
+	user := &GuestUser{}
+	requestURL := c.Endpoint + "/v1.0/users/" + url.PathEscape(id) + "?$select=id,displayName,userType,mail,userPrincipalName,identities"
+	if err := c.Do(ctx, http.MethodGet, requestURL, nil, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// FindTenantByDomain returns the ID of the Microsoft Entra tenant that has verified domain
+func (c *GraphClient) FindTenantByDomain(ctx context.Context, domain string) (string, error) {
+	var tenant struct {
+		TenantID string `json:"tenantId"`
+	}
+	requestURL := fmt.Sprintf("%s/v1.0/tenantRelationships/findTenantInformationByDomainName(domainName='%s')", c.Endpoint, url.PathEscape(domain))
+	if err := c.Do(ctx, http.MethodGet, requestURL, nil, &tenant); err != nil {
+		return "", err
+	}
+	return tenant.TenantID, nil
+}
+
+// GetDirectoryObjects resolves object IDs to users, groups and service principals.
+// IDs that do not exist in the tenant are omitted from the result.
+func (c *GraphClient) GetDirectoryObjects(ctx context.Context, ids []string) ([]DirectoryObject, error) {
+	var objects []DirectoryObject
+	for start := 0; start < len(ids); start += 1000 {
+		end := start + 1000
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var page struct {
+			Value []DirectoryObject `json:"value"`
+		}
+		body := map[string]interface{}{"ids": ids[start:end], "types": []string{"user", "group", "servicePrincipal"}}
+		if err := c.Do(ctx, http.MethodPost, c.Endpoint+"/v1.0/directoryObjects/getByIds", body, &page); err != nil {
+			return nil, err
+		}
+		objects = append(objects, page.Value...)
+	}
+	return objects, nil
+}
+
+// -----
+// Conditional Access
+// -----
+
+// ConditionalAccessPolicy is the subset of a Graph conditionalAccessPolicy read by the raid
+type ConditionalAccessPolicy struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+	State       string `json:"state"` // enabled, disabled or enabledForReportingButNotEnforced
+	Conditions  struct {
+		Users struct {
+			IncludeUsers                 []string        `json:"includeUsers"`
+			ExcludeUsers                 []string        `json:"excludeUsers"`
+			IncludeGroups                []string        `json:"includeGroups"`
+			ExcludeGroups                []string        `json:"excludeGroups"`
+			IncludeRoles                 []string        `json:"includeRoles"`
+			ExcludeRoles                 []string        `json:"excludeRoles"`
+			ExcludeGuestsOrExternalUsers json.RawMessage `json:"excludeGuestsOrExternalUsers"`
+		} `json:"users"`
+		Applications struct {
+			IncludeApplications []string `json:"includeApplications"`
+			ExcludeApplications []string `json:"excludeApplications"`
+		} `json:"applications"`
+		ClientAppTypes []string `json:"clientAppTypes"`
+		Locations      *struct {
+			IncludeLocations []string `json:"includeLocations"`
+			ExcludeLocations []string `json:"excludeLocations"`
+		} `json:"locations"`
+		Platforms *struct {
+			IncludePlatforms []string `json:"includePlatforms"`
+			ExcludePlatforms []string `json:"excludePlatforms"`
+		} `json:"platforms"`
+		UserRiskLevels   []string `json:"userRiskLevels"`
+		SignInRiskLevels []string `json:"signInRiskLevels"`
+	} `json:"conditions"`
+	GrantControls *struct {
+		Operator               string          `json:"operator"`
+		BuiltInControls        []string        `json:"builtInControls"`
+		AuthenticationStrength json.RawMessage `json:"authenticationStrength"`
+	} `json:"grantControls"`
+}
+
+// ListConditionalAccessPolicies returns every Conditional Access policy in the tenant
+func (c *GraphClient) ListConditionalAccessPolicies(ctx context.Context) ([]ConditionalAccessPolicy, error) {
+	var policies []ConditionalAccessPolicy
+	err := c.List(ctx, "/v1.0/identity/conditionalAccess/policies", func(item json.RawMessage) error {
+		var policy ConditionalAccessPolicy
+		if err := json.Unmarshal(item, &policy); err != nil {
+			return err
+		}
+		policies = append(policies, policy)
+		return nil
+	})
+	return policies, err
+}
+
+// requiresMFA reports whether the policy is enforced and cannot be satisfied without multifactor authentication
+func (p *ConditionalAccessPolicy) requiresMFA() bool {
+	if p.State != "enabled" || p.GrantControls == nil {
+		return false
+	}
+	controls := p.GrantControls
+	strength := len(controls.AuthenticationStrength) > 0 && string(controls.AuthenticationStrength) != "null"
+	mfa := strength || containsFold(controls.BuiltInControls, "mfa")
+	if !mfa {
+		return false
+	}
+	// with OR, any other control on its own is enough to satisfy the policy
+	alternatives := len(controls.BuiltInControls)
+	if strength {
+		alternatives++
+	}
+	return alternatives == 1 || !strings.EqualFold(controls.Operator, "OR")
+}
+
+// appliesTo reports whether sign-ins to appID are in scope, ignoring who is signing in
+func (p *ConditionalAccessPolicy) appliesTo(appID string) bool {
+	applications := p.Conditions.Applications
+	if containsFold(applications.ExcludeApplications, appID) {
+		return false
+	}
+	return containsFold(applications.IncludeApplications, "All") || containsFold(applications.IncludeApplications, appID)
+}
+
+// narrowing lists the conditions that limit the policy to some sign-ins, such as particular locations or risk levels
+func (p *ConditionalAccessPolicy) narrowing() []string {
+	var conditions []string
+	clientApps := p.Conditions.ClientAppTypes
+	if len(clientApps) > 0 && !containsFold(clientApps, "all") &&
+		!(containsFold(clientApps, "browser") && containsFold(clientApps, "mobileAppsAndDesktopClients")) {
+		conditions = append(conditions, "client apps "+strings.Join(clientApps, ","))
+	}
+	if locations := p.Conditions.Locations; locations != nil {
+		if !containsFold(locations.IncludeLocations, "All") {
+			conditions = append(conditions, "only some locations")
+		} else if len(locations.ExcludeLocations) > 0 {
+			conditions = append(conditions, "excluded locations")
+		}
+	}
+	if platforms := p.Conditions.Platforms; platforms != nil {
+		if !containsFold(platforms.IncludePlatforms, "all") {
+			conditions = append(conditions, "only some platforms")
+		} else if len(platforms.ExcludePlatforms) > 0 {
+			conditions = append(conditions, "excluded platforms")
+		}
+	}
+	if len(p.Conditions.UserRiskLevels) > 0 {
+		conditions = append(conditions, "user risk")
+	}
+	if len(p.Conditions.SignInRiskLevels) > 0 {
+		conditions = append(conditions, "sign-in risk")
+	}
+	return conditions
+}
+
+// MFAPolicy holds the settings read from raids.ABS.mfa
+type MFAPolicy struct {
+	PrivilegedRoles   map[string]string // Role template ID to display name
+	AllowedExclusions []string          // Object IDs, such as break-glass accounts, that may be excluded from MFA policies
+}
+
+// LoadMFAPolicy reads raids.ABS.mfa, defaulting to the built-in administrator roles
+func LoadMFAPolicy() MFAPolicy {
+	policy := MFAPolicy{
+		PrivilegedRoles:   PrivilegedRoles,
+		AllowedExclusions: viper.GetStringSlice("raids.ABS.mfa.allowed_exclusions"),
+	}
+	if viper.IsSet("raids.ABS.mfa.privileged_roles") {
+		policy.PrivilegedRoles = make(map[string]string)
+		for _, role := range viper.GetStringSlice("raids.ABS.mfa.privileged_roles") {
+			name, ok := PrivilegedRoles[strings.ToLower(role)]
+			if !ok {
+				name = role
+			}
+			policy.PrivilegedRoles[strings.ToLower(role)] = name
+		}
+	}
+	return policy
+}
+
+// MFACoverage describes how Conditional Access requires MFA for one population signing in to one application
+type MFACoverage struct {
+	Policies    []string // Display names of the enforced policies requiring MFA for the population
+	Partial     []string // Policies that would cover the population but only under narrowing conditions
+	FallThrough []string // Principals excluded from every covering policy and not included again elsewhere
+}
+
+// Covered reports whether at least one policy applies and nobody falls through its exclusions
+func (c MFACoverage) Covered() bool {
+	return len(c.Policies) > 0 && len(c.FallThrough) == 0
+}
+
+// EvaluateMFACoverage works out which policies require MFA for appID.
+// An empty role evaluates coverage of all users; otherwise coverage of holders of the role template ID.
+func EvaluateMFACoverage(policies []ConditionalAccessPolicy, appID, role string, allowed []string) MFACoverage {
+	var coverage MFACoverage
+	var covering []*ConditionalAccessPolicy
+	included := make(map[string]bool) // principals explicitly targeted by any MFA policy for the app
+
+	for i := range policies {
+		policy := &policies[i]
+		if !policy.requiresMFA() || !policy.appliesTo(appID) {
+			continue
+		}
+		users := policy.Conditions.Users
+		if len(policy.narrowing()) == 0 {
+			for _, ids := range [][]string{users.IncludeUsers, users.IncludeGroups, users.IncludeRoles} {
+				for _, id := range ids {
+					included[strings.ToLower(id)] = true
+				}
+			}
+		}
+
+		targeted := containsFold(users.IncludeUsers, "All") || role != "" && containsFold(users.IncludeRoles, role)
+		if !targeted || role != "" && containsFold(users.ExcludeRoles, role) {
+			continue
+		}
+		if conditions := policy.narrowing(); len(conditions) > 0 {
+			coverage.Partial = append(coverage.Partial, fmt.Sprintf("%s (%s)", policy.DisplayName, strings.Join(conditions, ", ")))
+			continue
+		}
+		covering = append(covering, policy)
+		coverage.Policies = append(coverage.Policies, policy.DisplayName)
+	}
+	if len(covering) == 0 {
+		return coverage
+	}
+
+	// a principal falls through only if every covering policy excludes it
+	excludedBy := make(map[string]int)
+	for _, policy := range covering {
+		users := policy.Conditions.Users
+		seen := make(map[string]bool)
+		exclusions := map[string][]string{"user": users.ExcludeUsers, "group": users.ExcludeGroups}
+		if role == "" {
+			// when evaluating a single role, other excluded roles do not affect its holders
+			exclusions["role"] = users.ExcludeRoles
+		}
+		for kind, ids := range exclusions {
+			for _, id := range ids {
+				seen[kind+" "+strings.ToLower(id)] = true
+			}
+		}
+		if len(users.ExcludeGuestsOrExternalUsers) > 0 && string(users.ExcludeGuestsOrExternalUsers) != "null" {
+			seen["guests or external users"] = true
+		}
+		for principal := range seen {
+			excludedBy[principal]++
+		}
+	}
+	for principal, count := range excludedBy {
+		id := principal[strings.Index(principal, " ")+1:]
+		if count < len(covering) || included[id] || containsFold(allowed, id) {
+			continue
+		}
+		if name, ok := PrivilegedRoles[id]; ok {
+			principal = "role " + name
+		}
+		coverage.FallThrough = append(coverage.FallThrough, principal)
+	}
+	sort.Strings(coverage.FallThrough)
+	return coverage
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package armory
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const globalAdministrator = "62e90394-69f5-4237-9190-012177145e10"
+
+// newFakeGraph serves canned Microsoft Graph responses from the same stand-in used for Resource Manager
+func newFakeGraph(t *testing.T, responses map[string]string) (*fakeARM, *GraphClient) {
+	fake, _ := newFakeARM(t, responses)
+	cloud := Clouds[defaultCloud]
+	cloud.GraphEndpoint = fake.URL
+	return fake, NewGraphClient(cloud, staticCredential{}, fake.Client())
+}
+
+// conditionalAccessFixture holds a tenant where all users need MFA except a break-glass account and Global Administrators,
+// who are only covered off the corporate network; the second page holds policies that never require MFA
+var conditionalAccessFixture = map[string]string{
+	"GET /v1.0/identity/conditionalAccess/policies": `{"value":[
+		{"id":"1","displayName":"Require MFA for all users","state":"enabled",
+		 "conditions":{"users":{"includeUsers":["All"],"excludeUsers":["break-glass"],"excludeRoles":["` + globalAdministrator + `"]},
+		               "applications":{"includeApplications":["All"]},"clientAppTypes":["all"]},
+		 "grantControls":{"operator":"OR","builtInControls":["mfa"]}},
+		{"id":"2","displayName":"Administrators off network","state":"enabled",
+		 "conditions":{"users":{"includeRoles":["` + globalAdministrator + `"]},
+		               "applications":{"includeApplications":["All"]},"clientAppTypes":["all"],
+		               "locations":{"includeLocations":["All"],"excludeLocations":["AllTrusted"]}},
+		 "grantControls":{"operator":"AND","builtInControls":["mfa"]}}
+	],"@odata.nextLink":"{{server}}/v1.0/identity/conditionalAccess/policies/page2"}`,
+	"GET /v1.0/identity/conditionalAccess/policies/page2": `{"value":[
+		{"id":"3","displayName":"Report only","state":"enabledForReportingButNotEnforced",
+		 "conditions":{"users":{"includeUsers":["All"]},"applications":{"includeApplications":["All"]}},
+		 "grantControls":{"operator":"OR","builtInControls":["mfa"]}},
+		{"id":"4","displayName":"MFA or compliant device","state":"enabled",
+		 "conditions":{"users":{"includeRoles":["` + globalAdministrator + `"]},"applications":{"includeApplications":["All"]}},
+		 "grantControls":{"operator":"OR","builtInControls":["mfa","compliantDevice"]}}
+	]}`,
+}
+
+func TestEvaluateMFACoverageFromGraph(t *testing.T) {
+	_, graph := newFakeGraph(t, conditionalAccessFixture)
+	policies, err := graph.ListConditionalAccessPolicies(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 4 {
+		t.Fatalf("read %d policies across both pages, want 4", len(policies))
+	}
+
+	everyone := EvaluateMFACoverage(policies, AzureStorageAppID, "", nil)
+	if strings.Join(everyone.Policies, ",") != "Require MFA for all users" {
+		t.Errorf("all users covered by %v", everyone.Policies)
+	}
+	if strings.Join(everyone.FallThrough, ",") != "role Global Administrator,user break-glass" {
+		t.Errorf("fall through %v", everyone.FallThrough)
+	}
+
+	allowed := EvaluateMFACoverage(policies, AzureStorageAppID, "", []string{"break-glass", globalAdministrator})
+	if !allowed.Covered() {
+		t.Errorf("allowed exclusions still fall through: %v", allowed.FallThrough)
+	}
+
+	admins := EvaluateMFACoverage(policies, AzureResourceManagerAppID, globalAdministrator, nil)
+	if admins.Covered() || len(admins.Policies) != 0 {
+		t.Errorf("Global Administrators covered by %v", admins.Policies)
+	}
+	if len(admins.Partial) != 1 || !strings.Contains(admins.Partial[0], "Administrators off network (excluded locations)") {
+		t.Errorf("partial coverage %v", admins.Partial)
+	}
+}
+
+func TestMFAMovementsFromGraph(t *testing.T) {
+	_, graph := newFakeGraph(t, conditionalAccessFixture)
+	abs := &ABS{Graph: graph}
+	t.Cleanup(viper.Reset)
+
+	result := abs.CCC_C03_TR01_T01()
+	if result.Passed || !strings.Contains(result.Message, "all users of Azure Storage: role Global Administrator, user break-glass excluded from Require MFA for all users") {
+		t.Errorf("all users: passed=%t %s", result.Passed, result.Message)
+	}
+
+	viper.Set("raids.ABS.mfa.privileged_roles", []string{globalAdministrator})
+	result = abs.CCC_C03_TR02_T01()
+	if result.Passed || !strings.Contains(result.Message, "Global Administrator on Azure Resource Manager: MFA is only required conditionally") {
+		t.Errorf("privileged roles: passed=%t %s", result.Passed, result.Message)
+	}
+}
@@ -0,0 +1,263 @@
+package armory
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// HTTPConfig holds the network settings shared by every request the raid makes, read from raids.ABS.http
+type HTTPConfig struct {
+	ProxyURL          string        // Empty to honour HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+	CABundle          string        // PEM file of extra trusted roots, added to the system pool
+	ClientCertificate string        // PEM certificate presented for mutual TLS
+	ClientKey         string        // PEM key for ClientCertificate
+	Timeout           time.Duration // Applies to each whole request and to each connection attempt
+	MaxAttempts       int           // Total tries for idempotent requests that fail with a network error, 429 or 5xx
+	RetryDelay        time.Duration // Initial backoff, doubled after every retry
+}
+
+// LoadHTTPConfig reads raids.ABS.http, applying defaults for unset values
+func LoadHTTPConfig() HTTPConfig {
+	config := HTTPConfig{
+		ProxyURL:          viper.GetString("raids.ABS.http.proxy_url"),
+		CABundle:          viper.GetString("raids.ABS.http.ca_bundle"),
+		ClientCertificate: viper.GetString("raids.ABS.http.client_certificate"),
+		ClientKey:         viper.GetString("raids.ABS.http.client_key"),
+		Timeout:           30 * time.Second,
+		MaxAttempts:       3,
+		RetryDelay:        time.Second,
+	}
+	if viper.IsSet("raids.ABS.http.timeout_seconds") {
+		config.Timeout = time.Duration(viper.GetInt("raids.ABS.http.timeout_seconds")) * time.Second
+	}
+	if viper.IsSet("raids.ABS.http.retry.max_attempts") {
+		config.MaxAttempts = viper.GetInt("raids.ABS.http.retry.max_attempts")
+	}
+	if viper.IsSet("raids.ABS.http.retry.delay_seconds") {
+		config.RetryDelay = time.Duration(viper.GetFloat64("raids.ABS.http.retry.delay_seconds") * float64(time.Second))
+	}
+	return config
+}
+
+// proxyFor returns the proxy to use for requests to target, or nil to connect directly
+func (c HTTPConfig) proxyFor(target *url.URL) (*url.URL, error) {
+	// the managed identity endpoint and local emulators are never reachable through a proxy
+	if ip := net.ParseIP(target.Hostname()); (ip != nil && (ip.IsLoopback() || ip.IsLinkLocalUnicast())) || target.Hostname() == "localhost" {
+		return nil, nil
+	}
+	if c.ProxyURL == "" {
+		return http.ProxyFromEnvironment(&http.Request{URL: target})
+	}
+	return url.Parse(c.ProxyURL)
+}
+
+// TLSConfig returns the client TLS settings with the extra CA bundle and client certificate applied
+func (c HTTPConfig) TLSConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CABundle != "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		bundle, err := os.ReadFile(c.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle: %v", err)
+		}
+		if !roots.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("CA bundle %s contains no PEM certificates", c.CABundle)
+		}
+		config.RootCAs = roots
+	}
+	if c.ClientCertificate != "" || c.ClientKey != "" {
+		certificate, err := tls.LoadX509KeyPair(c.ClientCertificate, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// NewHTTPClient builds the client shared by every movement, ARM request and token request
+func NewHTTPClient(config HTTPConfig) (*http.Client, error) {
+	tlsConfig, err := config.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		Proxy: func(request *http.Request) (*url.URL, error) {
+			return config.proxyFor(request.URL)
+		},
+		DialContext:           (&net.Dialer{Timeout: config.Timeout}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   config.Timeout,
+		ResponseHeaderTimeout: config.Timeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   10,
+		ForceAttemptHTTP2:     true,
+	}
+	return &http.Client{
+		Timeout:   config.Timeout,
+		Transport: &retryTransport{next: transport, maxAttempts: config.MaxAttempts, delay: config.RetryDelay},
+	}, nil
+}
+
+// DialContext opens a TCP connection to address, tunnelling through the configured proxy with CONNECT when one applies.
+// Handshake probes use it so that they take the same network path as regular requests.
+func (c HTTPConfig) DialContext(ctx context.Context, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.Timeout}
+	proxy, err := c.proxyFor(&url.URL{Scheme: "https", Host: address})
+	if err != nil {
+		return nil, err
+	}
+	if proxy == nil {
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+
+	var defaultPort string
+	switch proxy.Scheme {
+	case "http":
+		defaultPort = "80"
+	case "https":
+		defaultPort = "443"
+	default:
+		return nil, fmt.Errorf("proxy scheme %q is not supported for handshake probes, use http or https", proxy.Scheme)
+	}
+	proxyAddress := proxy.Host
+	if proxy.Port() == "" {
+		proxyAddress = net.JoinHostPort(proxy.Hostname(), defaultPort)
+	}
+	connection, err := dialer.DialContext(ctx, "tcp", proxyAddress)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach proxy %s: %v", proxyAddress, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = connection.SetDeadline(deadline)
+	}
+	if proxy.Scheme == "https" {
+		// the CONNECT exchange is itself protected, as it is for regular requests through an https proxy
+		tlsConfig, err := c.TLSConfig()
+		if err != nil {
+			connection.Close()
+			return nil, err
+		}
+		tlsConfig.ServerName = proxy.Hostname()
+		secured := tls.Client(connection, tlsConfig)
+		if err := secured.HandshakeContext(ctx); err != nil {
+			connection.Close()
+			return nil, fmt.Errorf("unable to establish TLS with proxy %s: %v", proxyAddress, err)
+		}
+		connection = secured
+	}
+
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := request.Write(connection); err != nil {
+		connection.Close()
+		return nil, err
+	}
+	response, err := http.ReadResponse(bufio.NewReader(connection), request)
+	if err != nil {
+		connection.Close()
+		return nil, fmt.Errorf("proxy CONNECT failed: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		connection.Close()
+		return nil, fmt.Errorf("proxy refused CONNECT to %s: %s", address, response.Status)
+	}
+	_ = connection.SetDeadline(time.Time{})
+	return connection, nil
+}
+
+// noRetryKey marks a request context whose requests must be sent exactly once
+type noRetryKey struct{}
+
+// withoutRetries returns a context for requests whose first response is itself the observation, such as probes
+func withoutRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+// retryTransport retries idempotent requests that fail with a network error or a throttling or server error status
+type retryTransport struct {
+	next        http.RoundTripper
+	maxAttempts int
+	delay       time.Duration
+}
+
+func (t *retryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	delay := t.delay
+	for attempt := 1; ; attempt++ {
+		response, err := t.next.RoundTrip(request)
+		if attempt >= t.maxAttempts || !retryable(request, response, err) {
+			return response, err
+		}
+		// a body can only be sent again if the request knows how to recreate it
+		if request.Body != nil && request.GetBody == nil {
+			return response, err
+		}
+		wait := delay
+		if response != nil {
+			if seconds, parseErr := strconv.Atoi(response.Header.Get("Retry-After")); parseErr == nil {
+				wait = time.Duration(seconds) * time.Second
+			}
+			response.Body.Close()
+		}
+		select {
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		case <-time.After(wait):
+		}
+		if request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			request = request.Clone(request.Context())
+			request.Body = body
+		}
+		delay *= 2
+	}
+}
+
+func retryable(request *http.Request, response *http.Response, err error) bool {
+	if exempt, _ := request.Context().Value(noRetryKey{}).(bool); exempt {
+		return false
+	}
+	// a POST may have taken effect even though it failed, so sending it again could repeat it
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
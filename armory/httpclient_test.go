@@ -0,0 +1,155 @@
+package armory
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProxy tunnels every CONNECT to backend, whatever address was asked for, and answers plain requests itself
+type fakeProxy struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	connects []string
+	requests []string
+}
+
+func newFakeProxy(t *testing.T, backend string, secure bool) *fakeProxy {
+	fake := &fakeProxy{}
+	fake.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+		if r.Method != http.MethodConnect {
+			fake.requests = append(fake.requests, r.Method+" "+r.URL.String())
+			return
+		}
+		fake.connects = append(fake.connects, r.Host)
+		upstream, err := net.Dial("tcp", backend)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		client, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+		go func() {
+			io.Copy(upstream, client)
+			upstream.Close()
+		}()
+		go func() {
+			io.Copy(client, upstream)
+			client.Close()
+		}()
+	}))
+	if secure {
+		fake.StartTLS()
+	} else {
+		fake.Start()
+	}
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+func TestDialContextThroughProxy(t *testing.T) {
+	backend := newTLSServer(t, &tls.Config{MinVersion: tls.VersionTLS12})
+	backendAddress := strings.TrimPrefix(backend.URL, "https://")
+
+	t.Run("http", func(t *testing.T) {
+		proxy := newFakeProxy(t, backendAddress, false)
+		config := HTTPConfig{ProxyURL: proxy.URL, Timeout: 5 * time.Second}
+		probe := ProbeProtocol(config.DialContext, "https://account.blob.core.windows.net", tls.VersionTLS12)
+		if !probe.Accepted {
+			t.Errorf("handshake through the proxy failed: %s", probe)
+		}
+		if len(proxy.connects) != 1 || proxy.connects[0] != "account.blob.core.windows.net:443" {
+			t.Errorf("proxy received CONNECT for %v", proxy.connects)
+		}
+	})
+
+	t.Run("https", func(t *testing.T) {
+		proxy := newFakeProxy(t, backendAddress, true)
+		bundle := filepath.Join(t.TempDir(), "proxy-ca.pem")
+		if err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: proxy.Certificate().Raw}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		config := HTTPConfig{ProxyURL: proxy.URL, CABundle: bundle, Timeout: 5 * time.Second}
+		probe := ProbeProtocol(config.DialContext, "https://account.blob.core.windows.net", tls.VersionTLS12)
+		if !probe.Accepted {
+			t.Errorf("handshake through the https proxy failed: %s", probe)
+		}
+		if len(proxy.connects) != 1 {
+			t.Errorf("proxy received CONNECT for %v", proxy.connects)
+		}
+	})
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		config := HTTPConfig{ProxyURL: "socks5://127.0.0.1:1080", Timeout: time.Second}
+		if _, err := config.DialContext(context.Background(), "account.blob.core.windows.net:443"); err == nil || !strings.Contains(err.Error(), "socks5") {
+			t.Errorf("expected socks5 to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestNewHTTPClientUsesProxy(t *testing.T) {
+	proxy := newFakeProxy(t, "", false)
+	client, err := NewHTTPClient(HTTPConfig{ProxyURL: proxy.URL, Timeout: 5 * time.Second, MaxAttempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Get("http://account.blob.core.windows.net/?comp=list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if len(proxy.requests) != 1 || proxy.requests[0] != "GET http://account.blob.core.windows.net/?comp=list" {
+		t.Errorf("proxy received %v", proxy.requests)
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+	client := &http.Client{Transport: &retryTransport{next: http.DefaultTransport, maxAttempts: 3, delay: time.Millisecond}}
+
+	for name, test := range map[string]struct {
+		method string
+		ctx    context.Context
+		want   int32
+	}{
+		"idempotent request": {http.MethodGet, context.Background(), 3},
+		"POST":               {http.MethodPost, context.Background(), 1},
+		"probe":              {http.MethodGet, withoutRetries(context.Background()), 1},
+	} {
+		atomic.StoreInt32(&attempts, 0)
+		request, err := http.NewRequestWithContext(test.ctx, test.method, server.URL, strings.NewReader(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if got := atomic.LoadInt32(&attempts); got != test.want {
+			t.Errorf("%s was sent %d times, want %d", name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package armory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Built-in role granting exactly the get, wrapKey and unwrapKey operations needed for customer-managed keys
+const cryptoServiceEncryptionUserRole = "e147488a-f6f5-4113-8e2d-b22465e65bf6"
+
+// Key permissions an access policy may grant to the identity that wraps a storage account's data encryption keys
+var wrappingKeyPermissions = map[string]bool{"get": true, "wrapkey": true, "unwrapkey": true}
+
+// KeyReference identifies a key in an Azure Key Vault by its data-plane URI
+type KeyReference struct {
+	URI       string
+	VaultURI  string
+	VaultName string
+	KeyName   string
+	Version   string // Empty when the consumer follows the latest version automatically
+}
+
+// ParseKeyURI splits a key identifier such as https://vault.vault.azure.net/keys/name/version into its parts
+func ParseKeyURI(keyURI string) (KeyReference, error) {
+	parsed, err := url.Parse(keyURI)
+	if err != nil {
+		return KeyReference{}, fmt.Errorf("invalid key URI %q: %v", keyURI, err)
+	}
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if parsed.Scheme != "https" || parsed.Host == "" || len(segments) < 2 || len(segments) > 3 || segments[0] != "keys" {
+		return KeyReference{}, fmt.Errorf("%q is not a Key Vault key identifier", keyURI)
+	}
+	reference := KeyReference{
+		URI:       keyURI,
+		VaultURI:  "https://" + parsed.Host + "/",
+		VaultName: strings.Split(parsed.Hostname(), ".")[0],
+		KeyName:   segments[1],
+	}
+	if len(segments) == 3 {
+		reference.Version = segments[2]
+	}
+	return reference, nil
+}
+
+// accountKeyURI returns the identifier of the customer-managed key the account is encrypted with, or "" for Microsoft-managed keys
+func accountKeyURI(account *StorageAccount) string {
+	encryption := account.Properties.Encryption
+	if !strings.EqualFold(encryption.KeySource, "Microsoft.Keyvault") || encryption.KeyVaultProperties == nil {
+		return ""
+	}
+	properties := encryption.KeyVaultProperties
+	keyURI := strings.TrimSuffix(properties.KeyVaultURI, "/") + "/keys/" + properties.KeyName
+	if properties.KeyVersion != "" {
+		keyURI += "/" + properties.KeyVersion
+	}
+	return keyURI
+}
+
+// KeyUsage is what a consumer reports about the key version it currently wraps data with
+type KeyUsage struct {
+	Version      string    // Empty when the consumer does not report its current version
+	LastRotation time.Time // Zero when the consumer does not report when it last picked up a new version
+}
+
+// keyUsage reads the current versioned key identifier and last rotation time reported by an account or encryption scope
+func keyUsage(currentVersionedKeyIdentifier, lastKeyRotationTimestamp string) KeyUsage {
+	var usage KeyUsage
+	if reference, err := ParseKeyURI(currentVersionedKeyIdentifier); err == nil {
+		usage.Version = reference.Version
+	}
+	if rotated, err := time.Parse(time.RFC3339, lastKeyRotationTimestamp); err == nil {
+		usage.LastRotation = rotated
+	}
+	return usage
+}
+
+// accountKeyUsage returns the key version the account reports using, when it wraps data with a customer-managed key
+func accountKeyUsage(account *StorageAccount) KeyUsage {
+	properties := account.Properties.Encryption.KeyVaultProperties
+	if properties == nil {
+		return KeyUsage{}
+	}
+	return keyUsage(properties.CurrentVersionedKeyIdentifier, properties.LastKeyRotationTimestamp)
+}
+
+// TrustedKeys are the keys data may be encrypted with, read from raids.ABS.encryption.trusted_keys
+type TrustedKeys struct {
+	Keys   []KeyReference // A reference without a version trusts every version of the key
+	Vaults []string       // Names of vaults whose keys are all trusted
+}
+
+// LoadTrustedKeys reads raids.ABS.encryption.trusted_keys, where each entry is a key URI or a vault resource ID
+func LoadTrustedKeys() (TrustedKeys, error) {
+	var trusted TrustedKeys
+	for _, entry := range viper.GetStringSlice("raids.ABS.encryption.trusted_keys") {
+		if strings.HasPrefix(entry, "/") {
+			if !strings.Contains(strings.ToLower(entry), "/providers/microsoft.keyvault/vaults/") {
+				return trusted, fmt.Errorf("%q in raids.ABS.encryption.trusted_keys is not a key vault resource ID", entry)
+			}
+			trusted.Vaults = append(trusted.Vaults, resourceName(strings.TrimSuffix(entry, "/")))
+			continue
+		}
+		reference, err := ParseKeyURI(entry)
+		if err != nil {
+			return trusted, fmt.Errorf("invalid entry in raids.ABS.encryption.trusted_keys: %v", err)
+		}
+		trusted.Keys = append(trusted.Keys, reference)
+	}
+	return trusted, nil
+}
+
+// Trusts reports whether reference names a trusted key, or a key in a trusted vault
+func (t TrustedKeys) Trusts(reference KeyReference) bool {
+	if containsFold(t.Vaults, reference.VaultName) {
+		return true
+	}
+	for _, key := range t.Keys {
+		if strings.EqualFold(key.VaultURI, reference.VaultURI) && strings.EqualFold(key.KeyName, reference.KeyName) &&
+			(key.Version == "" || strings.EqualFold(key.Version, reference.Version)) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyVault is the subset of the Microsoft.KeyVault/vaults resource read by the raid
+type KeyVault struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Location   string `json:"location"`
+	Properties struct {
+		TenantID                string              `json:"tenantId"`
+		VaultURI                string              `json:"vaultUri"`
+		EnableSoftDelete        *bool               `json:"enableSoftDelete"` // Absent on vaults created after soft delete became mandatory
+		EnablePurgeProtection   *bool               `json:"enablePurgeProtection"`
+		EnableRbacAuthorization bool                `json:"enableRbacAuthorization"`
+		AccessPolicies          []VaultAccessPolicy `json:"accessPolicies"`
+	} `json:"properties"`
+}
+
+// VaultAccessPolicy grants data-plane permissions to one principal on a vault not using Azure RBAC
+type VaultAccessPolicy struct {
+	TenantID    string `json:"tenantId"`
+	ObjectID    string `json:"objectId"`
+	Permissions struct {
+		Keys         []string `json:"keys"`
+		Secrets      []string `json:"secrets"`
+		Certificates []string `json:"certificates"`
+		Storage      []string `json:"storage"`
+	} `json:"permissions"`
+}
+
+// KeyAttributes are the lifecycle attributes of a key or key version, as Unix timestamps
+type KeyAttributes struct {
+	Enabled bool  `json:"enabled"`
+	Created int64 `json:"created"`
+	Updated int64 `json:"updated"`
+	Exp     int64 `json:"exp"`
+}
+
+// VaultKey is a Microsoft.KeyVault/vaults/keys resource or one of its versions
+type VaultKey struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Properties struct {
+		KeyURI            string        `json:"keyUri"`
+		KeyURIWithVersion string        `json:"keyUriWithVersion"`
+		Attributes        KeyAttributes `json:"attributes"`
+		RotationPolicy    *struct {
+			LifetimeActions []struct {
+				Action struct {
+					Type string `json:"type"`
+				} `json:"action"`
+				Trigger struct {
+					TimeAfterCreate  string `json:"timeAfterCreate"`
+					TimeBeforeExpiry string `json:"timeBeforeExpiry"`
+				} `json:"trigger"`
+			} `json:"lifetimeActions"`
+			Attributes struct {
+				ExpiryTime string `json:"expiryTime"`
+			} `json:"attributes"`
+		} `json:"rotationPolicy"`
+	} `json:"properties"`
+}
+
+// FindKeyVault locates the vault called name, which may live in a different subscription from the account using it.
+// The given subscription is searched first, then every other subscription the credential can read.
+func (c *ARMClient) FindKeyVault(ctx context.Context, subscriptionID, name string) (*KeyVault, error) {
+	id, err := c.findVaultID(ctx, subscriptionID, name)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		others, err := c.otherSubscriptions(ctx, subscriptionID)
+		if err != nil {
+			return nil, fmt.Errorf("key vault %s was not found in subscription %s and %v", name, subscriptionID, err)
+		}
+		var unsearched []string
+		for _, subscription := range others {
+			found, err := c.findVaultID(ctx, subscription, name)
+			if err != nil {
+				unsearched = append(unsearched, subscription)
+				continue
+			}
+			if found != "" {
+				id = found
+				break
+			}
+		}
+		if id == "" {
+			if len(unsearched) > 0 {
+				return nil, fmt.Errorf("key vault %s was not found, and subscriptions %s could not be searched", name, strings.Join(unsearched, ", "))
+			}
+			return nil, fmt.Errorf("key vault %s was not found in any of the %d readable subscriptions", name, len(others)+1)
+		}
+	}
+
+	vault := &KeyVault{}
+	if err := c.Get(ctx, id, keyVaultAPIVersion, vault); err != nil {
+		return nil, err
+	}
+	return vault, nil
+}
+
+// findVaultID returns the resource ID of the vault called name in the subscription, or "" if it is not there
+func (c *ARMClient) findVaultID(ctx context.Context, subscriptionID, name string) (string, error) {
+	filter := fmt.Sprintf("resourceType eq 'Microsoft.KeyVault/vaults' and name eq '%s'", name)
+	path := fmt.Sprintf("/subscriptions/%s/resources?$filter=%s", subscriptionID, url.QueryEscape(filter))
+
+	var id string
+	err := c.List(ctx, path, resourcesAPIVersion, func(item json.RawMessage) error {
+		var resource struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(item, &resource); err != nil {
+			return err
+		}
+		id = resource.ID
+		return nil
+	})
+	return id, err
+}
+
+// GetVaultKey reads the management-plane view of a key, including its rotation policy
+func (c *ARMClient) GetVaultKey(ctx context.Context, vaultID, keyName string) (*VaultKey, error) {
+	key := &VaultKey{}
+	if err := c.Get(ctx, vaultID+"/keys/"+url.PathEscape(keyName), keyVaultAPIVersion, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListVaultKeyVersions returns every version of a key
+func (c *ARMClient) ListVaultKeyVersions(ctx context.Context, vaultID, keyName string) ([]VaultKey, error) {
+	var versions []VaultKey
+	err := c.List(ctx, vaultID+"/keys/"+url.PathEscape(keyName)+"/versions", keyVaultAPIVersion, func(item json.RawMessage) error {
+		var version VaultKey
+		if err := json.Unmarshal(item, &version); err != nil {
+			return err
+		}
+		versions = append(versions, version)
+		return nil
+	})
+	return versions, err
+}
+
+// KeyEvidence records the key a storage account or encryption scope uses and any issues found with it
+type KeyEvidence struct {
+	Consumer     string // The account or encryption scope that wraps its data with the key
+	KeyID        string
+	Version      string
+	LastRotation time.Time
+	Issues       []string
+}
+
+func (e KeyEvidence) String() string {
+	rotated := "unknown"
+	if !e.LastRotation.IsZero() {
+		rotated = e.LastRotation.UTC().Format(time.RFC3339)
+	}
+	version := e.Version
+	if version == "" {
+		version = "unknown"
+	}
+	return fmt.Sprintf("%s uses key %s version %s, last rotated %s", e.Consumer, e.KeyID, version, rotated)
+}
+
+// KeyAudit checks the customer-managed keys used by one storage account
+type KeyAudit struct {
+	ARM            *ARMClient
+	SubscriptionID string // Subscription searched for the vaults named in key URIs
+	PrincipalID    string // Identity the storage service uses to wrap and unwrap data encryption keys
+}
+
+// wrappingPrincipal returns the principal ID of the identity the account uses to reach its key vault
+func wrappingPrincipal(account *StorageAccount) (string, error) {
+	if account.Identity == nil {
+		return "", fmt.Errorf("account has no managed identity")
+	}
+	encryption := account.Properties.Encryption
+	if encryption.Identity != nil && encryption.Identity.UserAssignedIdentity != "" {
+		for id, identity := range account.Identity.UserAssignedIdentities {
+			if strings.EqualFold(id, encryption.Identity.UserAssignedIdentity) {
+				return identity.PrincipalID, nil
+			}
+		}
+		return "", fmt.Errorf("user-assigned identity %s is not attached to the account", encryption.Identity.UserAssignedIdentity)
+	}
+	if account.Identity.PrincipalID == "" {
+		return "", fmt.Errorf("account has no system-assigned identity")
+	}
+	return account.Identity.PrincipalID, nil
+}
+
+// Audit resolves reference and checks its vault, key and permissions, returning the evidence gathered.
+// The version in use and its rotation time come from usage, as reported by the consumer, because a newer version in
+// the vault only protects data once the consumer has picked it up.
+func (k *KeyAudit) Audit(ctx context.Context, consumer string, reference KeyReference, usage KeyUsage) KeyEvidence {
+	evidence := KeyEvidence{
+		Consumer:     consumer,
+		KeyID:        strings.TrimSuffix(reference.VaultURI, "/") + "/keys/" + reference.KeyName,
+		Version:      usage.Version,
+		LastRotation: usage.LastRotation,
+	}
+	if evidence.Version == "" {
+		evidence.Version = reference.Version
+	}
+	if reference.Version != "" {
+		evidence.Issues = append(evidence.Issues, fmt.Sprintf("pinned to version %s, so new key versions are not picked up automatically", reference.Version))
+	}
+
+	vault, err := k.ARM.FindKeyVault(ctx, k.SubscriptionID, reference.VaultName)
+	if err != nil {
+		evidence.Issues = append(evidence.Issues, fmt.Sprintf("unable to read vault: %v", err))
+		return evidence
+	}
+	if vault.Properties.EnableSoftDelete != nil && !*vault.Properties.EnableSoftDelete {
+		evidence.Issues = append(evidence.Issues, fmt.Sprintf("vault %s has soft delete disabled", vault.Name))
+	}
+	if vault.Properties.EnablePurgeProtection == nil || !*vault.Properties.EnablePurgeProtection {
+		evidence.Issues = append(evidence.Issues, fmt.Sprintf("vault %s does not have purge protection", vault.Name))
+	}
+
+	key, err := k.ARM.GetVaultKey(ctx, vault.ID, reference.KeyName)
+	if err != nil {
+		evidence.Issues = append(evidence.Issues, fmt.Sprintf("unable to read key: %v", err))
+	} else {
+		evidence.Issues = append(evidence.Issues, keyLifecycleIssues(key)...)
+	}
+
+	versions, err := k.ARM.ListVaultKeyVersions(ctx, vault.ID, reference.KeyName)
+	if err != nil {
+		evidence.Issues = append(evidence.Issues, fmt.Sprintf("unable to list key versions: %v", err))
+	}
+	var newest VaultKey
+	for _, version := range versions {
+		if version.Properties.Attributes.Created > newest.Properties.Attributes.Created {
+			newest = version
+		}
+		// without a reported rotation time, the version in use was last rotated when it was created
+		if evidence.LastRotation.IsZero() && evidence.Version != "" && strings.EqualFold(version.Name, evidence.Version) {
+			evidence.LastRotation = time.Unix(version.Properties.Attributes.Created, 0)
+		}
+	}
+	if reference.Version == "" && evidence.Version != "" && newest.Name != "" && !strings.EqualFold(newest.Name, evidence.Version) {
+		evidence.Issues = append(evidence.Issues, fmt.Sprintf("still uses version %s although the vault holds newer version %s, created %s",
+			evidence.Version, newest.Name, time.Unix(newest.Properties.Attributes.Created, 0).UTC().Format(time.RFC3339)))
+	}
+
+	evidence.Issues = append(evidence.Issues, k.permissionIssues(ctx, vault)...)
+	return evidence
+}
+
+func keyLifecycleIssues(key *VaultKey) []string {
+	var issues []string
+	attributes := key.Properties.Attributes
+	switch {
+	case attributes.Exp == 0:
+		issues = append(issues, "key has no expiry date")
+	case time.Unix(attributes.Exp, 0).Before(time.Now()):
+		issues = append(issues, fmt.Sprintf("key expired on %s", time.Unix(attributes.Exp, 0).UTC().Format(time.RFC3339)))
+	}
+
+	rotates := false
+	if policy := key.Properties.RotationPolicy; policy != nil {
+		for _, action := range policy.LifetimeActions {
+			if strings.EqualFold(action.Action.Type, "rotate") {
+				rotates = true
+			}
+		}
+	}
+	if !rotates {
+		issues = append(issues, "key has no rotation policy with a rotate action")
+	}
+	return issues
+}
+
+// permissionIssues reports any access the wrapping identity holds on vault beyond get, wrapKey and unwrapKey
+func (k *KeyAudit) permissionIssues(ctx context.Context, vault *KeyVault) []string {
+	if !vault.Properties.EnableRbacAuthorization {
+		for _, policy := range vault.Properties.AccessPolicies {
+			if !strings.EqualFold(policy.ObjectID, k.PrincipalID) {
+				continue
+			}
+			var excess []string
+			for _, permission := range policy.Permissions.Keys {
+				if !wrappingKeyPermissions[strings.ToLower(permission)] {
+					excess = append(excess, "keys/"+permission)
+				}
+			}
+			for _, permission := range policy.Permissions.Secrets {
+				excess = append(excess, "secrets/"+permission)
+			}
+			for _, permission := range policy.Permissions.Certificates {
+				excess = append(excess, "certificates/"+permission)
+			}
+			if len(excess) > 0 {
+				sort.Strings(excess)
+				return []string{fmt.Sprintf("access policy grants the wrapping identity %s", strings.Join(excess, ", "))}
+			}
+			return nil
+		}
+		return []string{"no access policy grants the wrapping identity access to the vault"}
+	}
+
+	assignments, err := k.ARM.ListRoleAssignments(ctx, vault.ID, fmt.Sprintf("assignedTo('%s')", k.PrincipalID))
+	if err != nil {
+		return []string{fmt.Sprintf("unable to list role assignments: %v", err)}
+	}
+	var excess []string
+	for _, assignment := range assignments {
+		definition := assignment.Properties.RoleDefinitionID
+		if strings.HasSuffix(strings.ToLower(definition), cryptoServiceEncryptionUserRole) {
+			continue
+		}
+		name, err := k.ARM.GetRoleName(ctx, definition)
+		if err != nil {
+			name = definition
+		}
+		excess = append(excess, fmt.Sprintf("%s at %s", name, assignment.Properties.Scope))
+	}
+	if len(excess) > 0 {
+		return []string{fmt.Sprintf("wrapping identity also holds %s", strings.Join(excess, ", "))}
+	}
+	if len(assignments) == 0 {
+		return []string{"wrapping identity has no role assignment on the vault"}
+	}
+	return nil
+}
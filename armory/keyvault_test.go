@@ -0,0 +1,82 @@
+package armory
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindKeyVaultSearchesOtherSubscriptions(t *testing.T) {
+	vaultID := "/subscriptions/sub-keys/resourceGroups/rg-security/providers/Microsoft.KeyVault/vaults/central"
+	fake, arm := newFakeARM(t, map[string]string{
+		"GET /subscriptions/sub-data/resources": `{"value":[]}`,
+		"GET /subscriptions":                    `{"value":[{"subscriptionId":"sub-data"},{"subscriptionId":"sub-keys"},{"subscriptionId":"sub-other"}]}`,
+		"GET /subscriptions/sub-keys/resources": `{"value":[{"id":"` + vaultID + `"}]}`,
+		"GET " + vaultID:                        `{"id":"` + vaultID + `","name":"central","properties":{"enablePurgeProtection":true}}`,
+	})
+
+	vault, err := arm.FindKeyVault(context.Background(), "sub-data", "central")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vault.ID != vaultID {
+		t.Errorf("found %s", vault.ID)
+	}
+	if fake.requested("GET /subscriptions/sub-other") {
+		t.Error("search continued after the vault was found")
+	}
+}
+
+func TestFindKeyVaultReportsUnsearchedSubscriptions(t *testing.T) {
+	_, arm := newFakeARM(t, map[string]string{
+		"GET /subscriptions/sub-data/resources": `{"value":[]}`,
+		"GET /subscriptions":                    `{"value":[{"subscriptionId":"sub-data"},{"subscriptionId":"sub-locked"}]}`,
+	})
+	_, err := arm.FindKeyVault(context.Background(), "sub-data", "central")
+	if err == nil || !strings.Contains(err.Error(), "sub-locked could not be searched") {
+		t.Errorf("expected the unreadable subscription to be named, got %v", err)
+	}
+}
+
+func TestKeyAuditReportsTheVersionInUse(t *testing.T) {
+	vaultID := "/subscriptions/sub-data/resourceGroups/rg-security/providers/Microsoft.KeyVault/vaults/central"
+	_, arm := newFakeARM(t, map[string]string{
+		"GET /subscriptions/sub-data/resources": `{"value":[{"id":"` + vaultID + `"}]}`,
+		"GET " + vaultID: `{"id":"` + vaultID + `","name":"central","properties":{"enableSoftDelete":true,"enablePurgeProtection":true,
+			"accessPolicies":[{"objectId":"principal-a","permissions":{"keys":["get","wrapKey","unwrapKey"]}}]}}`,
+		"GET " + vaultID + "/keys/cmk": `{"name":"cmk","properties":{"attributes":{"enabled":true,"exp":4102444800},
+			"rotationPolicy":{"lifetimeActions":[{"action":{"type":"Rotate"},"trigger":{"timeAfterCreate":"P90D"}}]}}}`,
+		"GET " + vaultID + "/keys/cmk/versions": `{"value":[
+			{"name":"v1","properties":{"attributes":{"enabled":true,"created":1700000000}}},
+			{"name":"v2","properties":{"attributes":{"enabled":true,"created":1710000000}}}]}`,
+	})
+	var account StorageAccount
+	err := json.Unmarshal([]byte(`{"properties":{"encryption":{"keySource":"Microsoft.Keyvault","keyvaultproperties":{
+		"keyvaulturi":"https://central.vault.azure.net/","keyname":"cmk",
+		"currentVersionedKeyIdentifier":"https://central.vault.azure.net/keys/cmk/v1",
+		"lastKeyRotationTimestamp":"2023-11-15T00:00:00Z"}}}}`), &account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reference, err := ParseKeyURI(accountKeyURI(&account))
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit := &KeyAudit{ARM: arm, SubscriptionID: "sub-data", PrincipalID: "principal-a"}
+
+	evidence := audit.Audit(context.Background(), "account privateerdata", reference, accountKeyUsage(&account))
+	if want := time.Date(2023, 11, 15, 0, 0, 0, 0, time.UTC); evidence.Version != "v1" || !evidence.LastRotation.Equal(want) {
+		t.Errorf("reported version %s rotated %v, want v1 rotated %v", evidence.Version, evidence.LastRotation, want)
+	}
+	if issues := strings.Join(evidence.Issues, "; "); !strings.Contains(issues, "still uses version v1 although the vault holds newer version v2") {
+		t.Errorf("expected the version not yet picked up to be reported, got %q", issues)
+	}
+
+	// an account that has picked up the newest version, without reporting when, was rotated when that version was created
+	evidence = audit.Audit(context.Background(), "account privateerdata", reference, KeyUsage{Version: "v2"})
+	if evidence.Version != "v2" || !evidence.LastRotation.Equal(time.Unix(1710000000, 0)) || len(evidence.Issues) != 0 {
+		t.Errorf("reported %s with issues %q", evidence, evidence.Issues)
+	}
+}
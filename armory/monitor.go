@@ -0,0 +1,307 @@
+package armory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// API versions used for Azure Monitor resources
+const (
+	insightsAPIVersion            = "2021-05-01-preview"
+	operationalInsightsAPIVersion = "2022-10-01"
+)
+
+// blobLogCategories are the resource log categories that record data-plane access to blobs
+var blobLogCategories = []string{"StorageRead", "StorageWrite", "StorageDelete"}
+
+// activityLogCategories are the Activity Log categories that record configuration, role and policy changes
+var activityLogCategories = []string{"Administrative", "Policy"}
+
+// DiagnosticSetting is a Microsoft.Insights/diagnosticSettings resource
+type DiagnosticSetting struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Properties struct {
+		WorkspaceID                 string `json:"workspaceId"`
+		StorageAccountID            string `json:"storageAccountId"`
+		EventHubAuthorizationRuleID string `json:"eventHubAuthorizationRuleId"`
+		EventHubName                string `json:"eventHubName"`
+		Logs                        []struct {
+			Category      string `json:"category"`
+			CategoryGroup string `json:"categoryGroup"`
+			Enabled       bool   `json:"enabled"`
+		} `json:"logs"`
+	} `json:"properties"`
+}
+
+// Destinations describes every sink the setting ships logs to
+func (s *DiagnosticSetting) Destinations() []string {
+	var destinations []string
+	if s.Properties.WorkspaceID != "" {
+		destinations = append(destinations, "Log Analytics workspace "+resourceName(s.Properties.WorkspaceID))
+	}
+	if s.Properties.StorageAccountID != "" {
+		destinations = append(destinations, "storage account "+resourceName(s.Properties.StorageAccountID))
+	}
+	if s.Properties.EventHubAuthorizationRuleID != "" {
+		hub := s.Properties.EventHubName
+		if hub == "" {
+			hub = "(default hub)"
+		}
+		destinations = append(destinations, "Event Hub "+hub)
+	}
+	return destinations
+}
+
+// Enables reports whether the setting ships category, either by name or through the allLogs category group
+func (s *DiagnosticSetting) Enables(category string) bool {
+	for _, log := range s.Properties.Logs {
+		if log.Enabled && (strings.EqualFold(log.Category, category) || strings.EqualFold(log.CategoryGroup, "allLogs")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListDiagnosticSettings returns the diagnostic settings attached to the resource
+func (c *ARMClient) ListDiagnosticSettings(ctx context.Context, resourceID string) ([]DiagnosticSetting, error) {
+	var settings []DiagnosticSetting
+	err := c.List(ctx, resourceID+"/providers/Microsoft.Insights/diagnosticSettings", insightsAPIVersion, func(item json.RawMessage) error {
+		var setting DiagnosticSetting
+		if err := json.Unmarshal(item, &setting); err != nil {
+			return err
+		}
+		settings = append(settings, setting)
+		return nil
+	})
+	return settings, err
+}
+
+// GetWorkspaceCustomerID returns the ID used to query the Log Analytics workspace with the given resource ID
+func (c *ARMClient) GetWorkspaceCustomerID(ctx context.Context, workspaceResourceID string) (string, error) {
+	var workspace struct {
+		Properties struct {
+			CustomerID string `json:"customerId"`
+		} `json:"properties"`
+	}
+	if err := c.Get(ctx, workspaceResourceID, operationalInsightsAPIVersion, &workspace); err != nil {
+		return "", err
+	}
+	return workspace.Properties.CustomerID, nil
+}
+
+// StorageReadWorkspaces returns the Log Analytics workspaces the account's diagnostic settings send StorageRead to
+func (c *ARMClient) StorageReadWorkspaces(ctx context.Context, target *Target) ([]string, error) {
+	settings, err := c.ListDiagnosticSettings(ctx, target.ResourceID()+"/blobServices/default")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list diagnostic settings: %v", err)
+	}
+	var workspaces []string
+	for _, setting := range settings {
+		if setting.Properties.WorkspaceID != "" && setting.Enables("StorageRead") {
+			workspaces = append(workspaces, setting.Properties.WorkspaceID)
+		}
+	}
+	return workspaces, nil
+}
+
+// blobLogWorkspace returns the resource ID and query ID of the Log Analytics workspace that the account's diagnostic
+// settings send StorageRead to. Both are empty, without an error, when StorageRead is not sent to any workspace.
+func (a *ABS) blobLogWorkspace(ctx context.Context, target *Target) (workspace, workspaceID string, err error) {
+	workspaces, err := a.ARM.StorageReadWorkspaces(ctx, target)
+	if err != nil || len(workspaces) == 0 {
+		return "", "", err
+	}
+	workspace = workspaces[0]
+	workspaceID, err = a.ARM.GetWorkspaceCustomerID(ctx, workspace)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to read workspace %s: %v", resourceName(workspace), err)
+	}
+	return workspace, workspaceID, nil
+}
+
+func resourceName(resourceID string) string {
+	return resourceID[strings.LastIndex(resourceID, "/")+1:]
+}
+
+// -----
+// Log Analytics
+// -----
+
+// LogQuerier runs KQL queries against a Log Analytics workspace.
+// LogAnalyticsClient is the production implementation; tests can substitute a fake on ABS.LogAnalytics.
+type LogQuerier interface {
+	Query(ctx context.Context, workspaceID, query string, timespan time.Duration) ([]map[string]interface{}, error)
+}
+
+// LogAnalyticsClient runs KQL queries against Log Analytics workspaces
+type LogAnalyticsClient struct {
+	Endpoint   string
+	Scope      string
+	Credential TokenCredential
+	HTTPClient *http.Client
+}
+
+// NewLogAnalyticsClient creates a client for the Log Analytics query endpoint of cloud
+func NewLogAnalyticsClient(cloud CloudEnvironment, credential TokenCredential, client *http.Client) *LogAnalyticsClient {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &LogAnalyticsClient{
+		Endpoint:   strings.TrimSuffix(cloud.LogAnalyticsEndpoint, "/"),
+		Scope:      cloud.LogAnalyticsScope,
+		Credential: credential,
+		HTTPClient: client,
+	}
+}
+
+// Query runs query against the workspace over the given timespan and returns each row keyed by column name
+func (c *LogAnalyticsClient) Query(ctx context.Context, workspaceID, query string, timespan time.Duration) ([]map[string]interface{}, error) {
+	token, err := c.Credential.GetToken(ctx, c.Scope)
+	if err != nil {
+		return nil, fmt.Errorf("unable to authenticate to Log Analytics: %v", err)
+	}
+	body, err := json.Marshal(map[string]string{
+		"query":    query,
+		"timespan": fmt.Sprintf("PT%dM", int(timespan.Minutes())),
+	})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/v1/workspaces/%s/query", c.Endpoint, workspaceID), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+token.Token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		var parsed struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &parsed) == nil && parsed.Error.Code != "" {
+			return nil, fmt.Errorf("log query failed with HTTP %d: %s: %s", response.StatusCode, parsed.Error.Code, parsed.Error.Message)
+		}
+		return nil, fmt.Errorf("log query failed with HTTP %d", response.StatusCode)
+	}
+
+	var parsed struct {
+		Tables []struct {
+			Columns []struct {
+				Name string `json:"name"`
+			} `json:"columns"`
+			Rows [][]interface{} `json:"rows"`
+		} `json:"tables"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("unable to parse log query response: %v", err)
+	}
+	var rows []map[string]interface{}
+	if len(parsed.Tables) > 0 {
+		table := parsed.Tables[0]
+		for _, values := range table.Rows {
+			row := make(map[string]interface{}, len(values))
+			for i, value := range values {
+				if i < len(table.Columns) {
+					row[table.Columns[i].Name] = value
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// LoggingPolicy holds the settings read from raids.ABS.logging
+type LoggingPolicy struct {
+	VerifyDelivery bool          // Perform a known request and wait for it to appear in the Log Analytics sink
+	VerifyChanges  bool          // Update a tag on the account and wait for the write to appear in the exported Activity Log
+	Timeout        time.Duration // How long to wait for the request to be ingested
+	PollInterval   time.Duration
+}
+
+// LoadLoggingPolicy reads raids.ABS.logging, defaulting to a 15 minute ingestion timeout
+func LoadLoggingPolicy() LoggingPolicy {
+	policy := LoggingPolicy{
+		VerifyDelivery: viper.GetBool("raids.ABS.logging.verify_delivery"),
+		VerifyChanges:  viper.GetBool("raids.ABS.logging.verify_configuration_changes"),
+		Timeout:        15 * time.Minute,
+		PollInterval:   30 * time.Second,
+	}
+	if viper.IsSet("raids.ABS.logging.timeout_minutes") {
+		policy.Timeout = time.Duration(viper.GetFloat64("raids.ABS.logging.timeout_minutes") * float64(time.Minute))
+	}
+	if viper.IsSet("raids.ABS.logging.poll_interval_seconds") {
+		policy.PollInterval = time.Duration(viper.GetFloat64("raids.ABS.logging.poll_interval_seconds") * float64(time.Second))
+	}
+	return policy
+}
+
+// WaitForLogs polls the workspace through querier until query returns at least one row or the timeout passes
+func WaitForLogs(ctx context.Context, querier LogQuerier, workspaceID, query string, policy LoggingPolicy) ([]map[string]interface{}, error) {
+	return waitForLogs(ctx, querier, workspaceID, query, policy, func(rows []map[string]interface{}) bool {
+		return len(rows) > 0
+	})
+}
+
+// WaitForOperations polls like WaitForLogs but keeps going until query has returned a row for every one of operations,
+// matched on the OperationName column, since entries for requests sent together can be ingested minutes apart.
+// When the timeout passes it returns the rows from the last poll, so the caller can tell which operations are missing.
+func WaitForOperations(ctx context.Context, querier LogQuerier, workspaceID, query string, policy LoggingPolicy, operations []string) ([]map[string]interface{}, error) {
+	return waitForLogs(ctx, querier, workspaceID, query, policy, func(rows []map[string]interface{}) bool {
+		for _, operation := range operations {
+			if operationRow(rows, operation) == nil {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// operationRow returns the first of rows whose OperationName is operation
+func operationRow(rows []map[string]interface{}, operation string) map[string]interface{} {
+	for _, row := range rows {
+		if name, _ := row["OperationName"].(string); strings.EqualFold(name, operation) {
+			return row
+		}
+	}
+	return nil
+}
+
+func waitForLogs(ctx context.Context, querier LogQuerier, workspaceID, query string, policy LoggingPolicy, complete func([]map[string]interface{}) bool) ([]map[string]interface{}, error) {
+	deadline := time.Now().Add(policy.Timeout)
+	for {
+		rows, err := querier.Query(ctx, workspaceID, query, policy.Timeout+time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		if complete(rows) || time.Now().Add(policy.PollInterval).After(deadline) {
+			return rows, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(policy.PollInterval):
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package armory
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// fakeLogQuerier answers the nth query with polls[n], repeating the last answer once they run out
+type fakeLogQuerier struct {
+	mutex   sync.Mutex
+	polls   [][]map[string]interface{}
+	err     error
+	queries []string
+}
+
+func (f *fakeLogQuerier) Query(ctx context.Context, workspaceID, query string, timespan time.Duration) ([]map[string]interface{}, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.queries = append(f.queries, query)
+	if f.err != nil {
+		return nil, f.err
+	}
+	if len(f.polls) == 0 {
+		return nil, nil
+	}
+	answer := f.polls[0]
+	if len(f.polls) > 1 {
+		f.polls = f.polls[1:]
+	}
+	return answer, nil
+}
+
+func TestWaitForLogs(t *testing.T) {
+	policy := LoggingPolicy{Timeout: time.Second, PollInterval: time.Millisecond}
+	row := map[string]interface{}{"Caller": "raid@example.com"}
+
+	querier := &fakeLogQuerier{polls: [][]map[string]interface{}{nil, nil, {row}}}
+	rows, err := WaitForLogs(context.Background(), querier, "workspace", "AzureActivity", policy)
+	if err != nil || len(rows) != 1 {
+		t.Errorf("got %v, %v", rows, err)
+	}
+	if len(querier.queries) != 3 {
+		t.Errorf("polled %d times, want 3", len(querier.queries))
+	}
+
+	policy.Timeout = 10 * time.Millisecond
+	rows, err = WaitForLogs(context.Background(), &fakeLogQuerier{}, "workspace", "AzureActivity", policy)
+	if err != nil || rows != nil {
+		t.Errorf("expected no rows and no error once the timeout passes, got %v, %v", rows, err)
+	}
+}
+
+func TestRefusedRequestIsTraced(t *testing.T) {
+	target := recordedTarget()
+	workspace := "/subscriptions/sub-logs/resourceGroups/rg-logs/providers/Microsoft.OperationalInsights/workspaces/central"
+	_, arm := newFakeARM(t, map[string]string{
+		"GET " + target.ResourceID() + "/blobServices/default/providers/Microsoft.Insights/diagnosticSettings": `{"value":[` +
+			`{"name":"audit","properties":{"workspaceId":"` + workspace + `","logs":[{"category":"StorageRead","enabled":true}]}}]}`,
+		"GET " + workspace: `{"properties":{"customerId":"workspace-guid"}}`,
+	})
+	blob, client := newFakeBlobService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ms-error-code", "AuthenticationFailed")
+		w.WriteHeader(http.StatusForbidden)
+	})
+	target.Endpoints.Blob = blob.URL
+	viper.Set("raids.ABS.logging.poll_interval_seconds", 0.001)
+	t.Cleanup(viper.Reset)
+
+	for name, test := range map[string]struct {
+		row    map[string]interface{}
+		passed bool
+		want   string
+	}{
+		"logged with caller": {
+			row:    map[string]interface{}{"CallerIpAddress": "203.0.113.7:50122", "StatusCode": 403.0, "StatusText": "SASAuthorizationError"},
+			passed: true,
+			want:   "was logged from 203.0.113.7:50122 with status 403 SASAuthorizationError",
+		},
+		"logged without caller": {
+			row:  map[string]interface{}{"StatusCode": 403.0, "StatusText": "SASAuthorizationError"},
+			want: "does not record the caller address",
+		},
+	} {
+		querier := &fakeLogQuerier{polls: [][]map[string]interface{}{nil, {test.row}}}
+		abs := &ABS{ARM: arm, LogAnalytics: querier, HTTPClient: client.HTTPClient}
+		result := abs.CCC_C05_TR02_T01(target)
+		if result.Passed != test.passed || !strings.Contains(result.Message, test.want) {
+			t.Errorf("%s: passed=%t %s", name, result.Passed, result.Message)
+		}
+		if !strings.Contains(querier.queries[0], "StorageBlobLogs") || !strings.Contains(querier.queries[0], "privateer-raid/ccc_c05_tr02_t01-") {
+			t.Errorf("%s: unexpected query %s", name, querier.queries[0])
+		}
+	}
+}
+
+func TestWaitForOperationsWaitsForEveryOperation(t *testing.T) {
+	policy := LoggingPolicy{Timeout: time.Second, PollInterval: time.Millisecond}
+	containers := map[string]interface{}{"OperationName": "ListContainers"}
+	blobs := map[string]interface{}{"OperationName": "ListBlobs"}
+
+	querier := &fakeLogQuerier{polls: [][]map[string]interface{}{{containers}, {containers}, {containers, blobs}}}
+	rows, err := WaitForOperations(context.Background(), querier, "workspace", "StorageBlobLogs", policy, []string{"ListContainers", "ListBlobs"})
+	if err != nil || len(rows) != 2 {
+		t.Errorf("got %v, %v", rows, err)
+	}
+	if len(querier.queries) != 3 {
+		t.Errorf("polled %d times, want 3", len(querier.queries))
+	}
+
+	policy.Timeout = 10 * time.Millisecond
+	querier = &fakeLogQuerier{polls: [][]map[string]interface{}{{containers}}}
+	rows, err = WaitForOperations(context.Background(), querier, "workspace", "StorageBlobLogs", policy, []string{"ListContainers", "ListBlobs"})
+	if err != nil || len(rows) != 1 || operationRow(rows, "ListBlobs") != nil {
+		t.Errorf("expected the partial rows from the last poll, got %v, %v", rows, err)
+	}
+}
+
+func TestEnumerationIsReadBackFromLogs(t *testing.T) {
+	target := recordedTarget()
+	target.Container = "raid"
+	workspace := "/subscriptions/sub-logs/resourceGroups/rg-logs/providers/Microsoft.OperationalInsights/workspaces/central"
+	_, arm := newFakeARM(t, map[string]string{
+		"GET " + target.ResourceID() + "/blobServices/default/providers/Microsoft.Insights/diagnosticSettings": `{"value":[` +
+			`{"name":"audit","properties":{"workspaceId":"` + workspace + `","logs":[{"categoryGroup":"audit","enabled":true},{"category":"StorageRead","enabled":true}]}}]}`,
+		"GET " + workspace: `{"properties":{"customerId":"workspace-guid"}}`,
+	})
+	var requestIDs []string
+	blob, client := newFakeBlobService(t, func(w http.ResponseWriter, r *http.Request) {
+		requestIDs = append(requestIDs, r.Header.Get("x-ms-client-request-id"))
+		w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Containers/><Blobs/><NextMarker/></EnumerationResults>`))
+	})
+	target.Endpoints.Blob = blob.URL
+	viper.Set("raids.ABS.logging.poll_interval_seconds", 0.001)
+	viper.Set("raids.ABS.logging.timeout_minutes", 0.001)
+	t.Cleanup(viper.Reset)
+
+	containers := map[string]interface{}{"OperationName": "ListContainers", "CallerIpAddress": "203.0.113.7", "RequesterUpn": "raid@example.com"}
+	blobs := map[string]interface{}{"OperationName": "ListBlobs", "CallerIpAddress": "203.0.113.7", "AuthenticationType": "AccountKey"}
+	querier := &fakeLogQuerier{polls: [][]map[string]interface{}{{containers}, {containers, blobs}}}
+	abs := &ABS{ARM: arm, LogAnalytics: querier, Credential: staticCredential{}, HTTPClient: client.HTTPClient}
+
+	result := abs.CCC_C07_TR02_T01(target)
+	if !result.Passed || !strings.Contains(result.Message, "ListBlobs by account key from 203.0.113.7") {
+		t.Errorf("passed=%t %s", result.Passed, result.Message)
+	}
+	if len(requestIDs) != 2 || requestIDs[0] == "" || requestIDs[0] != requestIDs[1] || !strings.Contains(querier.queries[0], requestIDs[0]) {
+		t.Errorf("requests tagged %v, query %s", requestIDs, querier.queries[0])
+	}
+
+	abs.LogAnalytics = &fakeLogQuerier{polls: [][]map[string]interface{}{{containers}}}
+	result = abs.CCC_C07_TR02_T01(target)
+	if result.Passed || !strings.Contains(result.Message, "ListBlobs tagged") {
+		t.Errorf("passed with ListBlobs missing: %s", result.Message)
+	}
+}
+
+func TestBlobLogCategories(t *testing.T) {
+	target := recordedTarget()
+	settings := "GET " + target.ResourceID() + "/blobServices/default/providers/Microsoft.Insights/diagnosticSettings"
+	workspace := "/subscriptions/sub-logs/resourceGroups/rg-logs/providers/Microsoft.OperationalInsights/workspaces/central"
+	archive := "/subscriptions/sub-logs/resourceGroups/rg-logs/providers/Microsoft.Storage/storageAccounts/archive"
+	for name, test := range map[string]struct {
+		settings string
+		passed   bool
+		want     []string
+	}{
+		"none": {`[]`, false, []string{"StorageRead is not shipped", "StorageWrite is not shipped", "StorageDelete is not shipped"}},
+		"all logs group": {`[{"name":"all","properties":{"workspaceId":"` + workspace + `","logs":[{"categoryGroup":"allLogs","enabled":true}]}}]`,
+			true, []string{"StorageRead shipped to Log Analytics workspace central", "StorageDelete shipped to Log Analytics workspace central"}},
+		"split across settings": {`[
+			{"name":"reads","properties":{"workspaceId":"` + workspace + `","logs":[{"category":"StorageRead","enabled":true},{"category":"StorageWrite","enabled":false}]}},
+			{"name":"writes","properties":{"storageAccountId":"` + archive + `","eventHubAuthorizationRuleId":"rule","logs":[{"category":"StorageWrite","enabled":true},{"category":"StorageDelete","enabled":true}]}}]`,
+			true, []string{"StorageRead shipped to Log Analytics workspace central", "StorageWrite shipped to storage account archive, Event Hub (default hub)"}},
+		"disabled category": {`[{"name":"reads","properties":{"workspaceId":"` + workspace + `","logs":[
+			{"category":"StorageRead","enabled":true},{"category":"StorageWrite","enabled":true},{"category":"StorageDelete","enabled":false}]}}]`,
+			false, []string{"StorageDelete is not shipped to any destination", "StorageWrite shipped to Log Analytics workspace central"}},
+	} {
+		_, arm := newFakeARM(t, map[string]string{settings: `{"value":` + test.settings + `}`})
+		result := (&ABS{ARM: arm}).CCC_C04_TR01_T01(target)
+		if result.Passed != test.passed {
+			t.Errorf("%s: passed=%t %s", name, result.Passed, result.Message)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(result.Message, want) {
+				t.Errorf("%s: message %q does not contain %q", name, result.Message, want)
+			}
+		}
+	}
+}
+
+func TestBlobReadIsDeliveredWithoutContainer(t *testing.T) {
+	target := recordedTarget()
+	workspace := "/subscriptions/sub-logs/resourceGroups/rg-logs/providers/Microsoft.OperationalInsights/workspaces/central"
+	_, arm := newFakeARM(t, map[string]string{
+		"GET " + target.ResourceID() + "/blobServices/default/providers/Microsoft.Insights/diagnosticSettings": `{"value":[` +
+			`{"name":"audit","properties":{"workspaceId":"` + workspace + `","logs":[{"category":"StorageRead","enabled":true}]}}]}`,
+		"GET " + workspace: `{"properties":{"customerId":"workspace-guid"}}`,
+	})
+	blob, client := newFakeBlobService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ms-error-code", "ContainerNotFound")
+		w.WriteHeader(http.StatusNotFound)
+	})
+	target.Endpoints.Blob = blob.URL
+	viper.Set("raids.ABS.logging.poll_interval_seconds", 0.001)
+	viper.Set("raids.ABS.logging.timeout_minutes", 0.001)
+	t.Cleanup(viper.Reset)
+
+	querier := &fakeLogQuerier{polls: [][]map[string]interface{}{{}, {{"CallerIpAddress": "203.0.113.7", "StatusText": "ContainerNotFound"}}}}
+	abs := &ABS{ARM: arm, LogAnalytics: querier, Credential: staticCredential{}, HTTPClient: client.HTTPClient}
+	result := abs.CCC_C04_TR01_T02(target)
+	if !result.Passed || !strings.Contains(result.Message, "appeared in workspace central") {
+		t.Errorf("passed=%t %s", result.Passed, result.Message)
+	}
+	if len(blob.requests) != 1 || !strings.HasPrefix(blob.requests[0], "GET /privateer-raid-nonexistent/privateer-raid/") {
+		t.Errorf("read %v, want one read from the probe container", blob.requests)
+	}
+	if !strings.Contains(querier.queries[0], strings.Fields(blob.requests[0])[1][len("/privateer-raid-nonexistent/"):]) {
+		t.Errorf("query %s does not look for the blob that was read", querier.queries[0])
+	}
+}
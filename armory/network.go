@@ -0,0 +1,137 @@
+package armory
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// NetworkAllowlist is the set of approved network paths into a storage account, read from raids.ABS.network.allowlist
+type NetworkAllowlist struct {
+	IPRanges         []*net.IPNet
+	VirtualNetworks  []string // Subnet resource IDs
+	Resources        []string // Resource IDs granted access through resource access rules
+	PrivateEndpoints []string // Private endpoint resource IDs
+	Bypass           []string // Trusted service exceptions that may be enabled
+}
+
+// LoadNetworkAllowlist reads raids.ABS.network.allowlist.
+// Bypass defaults to the trusted Azure service, logging and metrics exceptions when not set.
+func LoadNetworkAllowlist() (NetworkAllowlist, error) {
+	allowlist := NetworkAllowlist{
+		VirtualNetworks:  viper.GetStringSlice("raids.ABS.network.allowlist.virtual_networks"),
+		Resources:        viper.GetStringSlice("raids.ABS.network.allowlist.resources"),
+		PrivateEndpoints: viper.GetStringSlice("raids.ABS.network.allowlist.private_endpoints"),
+		Bypass:           []string{"AzureServices", "Logging", "Metrics"},
+	}
+	if viper.IsSet("raids.ABS.network.allowlist.bypass") {
+		allowlist.Bypass = viper.GetStringSlice("raids.ABS.network.allowlist.bypass")
+	}
+	for _, value := range viper.GetStringSlice("raids.ABS.network.allowlist.ip_ranges") {
+		network, err := parseIPRange(value)
+		if err != nil {
+			return allowlist, fmt.Errorf("invalid entry in raids.ABS.network.allowlist.ip_ranges: %v", err)
+		}
+		allowlist.IPRanges = append(allowlist.IPRanges, network)
+	}
+	return allowlist, nil
+}
+
+// parseIPRange accepts a CIDR range or a single address, as used by storage account IP rules
+func parseIPRange(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", value)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	return network, err
+}
+
+// permitsRange reports whether the whole of network lies within an approved range
+func (l NetworkAllowlist) permitsRange(network *net.IPNet) bool {
+	ones, bits := network.Mask.Size()
+	for _, approved := range l.IPRanges {
+		approvedOnes, approvedBits := approved.Mask.Size()
+		if approvedBits == bits && approvedOnes <= ones && approved.Contains(network.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Review compares the account's network configuration with the allowlist.
+// It returns the allowed paths into the account that are approved and those that are not.
+func (l NetworkAllowlist) Review(account *StorageAccount) (approved, unapproved []string) {
+	properties := account.Properties
+	if strings.EqualFold(properties.PublicNetworkAccess, "Disabled") {
+		approved = append(approved, "public network access disabled")
+	} else {
+		acls := properties.NetworkACLs
+		if !strings.EqualFold(acls.DefaultAction, "Deny") {
+			unapproved = append(unapproved, "default action allows every public address")
+		} else {
+			approved = append(approved, "default action Deny")
+		}
+
+		for _, rule := range acls.IPRules {
+			network, err := parseIPRange(rule.Value)
+			switch {
+			case err != nil:
+				unapproved = append(unapproved, fmt.Sprintf("unparseable IP rule %q", rule.Value))
+			case l.permitsRange(network):
+				approved = append(approved, "IP range "+rule.Value)
+			default:
+				unapproved = append(unapproved, "IP range "+rule.Value)
+			}
+		}
+		for _, rule := range acls.VirtualNetworkRules {
+			if containsFold(l.VirtualNetworks, rule.ID) {
+				approved = append(approved, "subnet "+rule.ID)
+			} else {
+				unapproved = append(unapproved, "subnet "+rule.ID)
+			}
+		}
+		for _, rule := range acls.ResourceAccessRules {
+			if containsFold(l.Resources, rule.ResourceID) {
+				approved = append(approved, "resource "+rule.ResourceID)
+			} else {
+				unapproved = append(unapproved, fmt.Sprintf("resource %s in tenant %s", rule.ResourceID, rule.TenantID))
+			}
+		}
+		for _, bypass := range strings.Split(acls.Bypass, ",") {
+			bypass = strings.TrimSpace(bypass)
+			if bypass == "" || strings.EqualFold(bypass, "None") {
+				continue
+			}
+			if containsFold(l.Bypass, bypass) {
+				approved = append(approved, "bypass "+bypass)
+			} else {
+				unapproved = append(unapproved, "bypass "+bypass)
+			}
+		}
+	}
+
+	// private endpoints remain reachable even when public network access is disabled
+	for _, connection := range properties.PrivateEndpointConnections {
+		state := connection.Properties.PrivateLinkServiceConnectionState.Status
+		if !strings.EqualFold(state, "Approved") {
+			continue
+		}
+		endpoint := connection.Properties.PrivateEndpoint.ID
+		if containsFold(l.PrivateEndpoints, endpoint) {
+			approved = append(approved, "private endpoint "+endpoint)
+		} else {
+			unapproved = append(unapproved, "private endpoint "+endpoint)
+		}
+	}
+	return approved, unapproved
+}
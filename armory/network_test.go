@@ -0,0 +1,164 @@
+package armory
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseIPRange(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		want  string // Empty when value must be rejected
+	}{
+		{"203.0.113.0/24", "203.0.113.0/24"},
+		{"203.0.113.7/24", "203.0.113.0/24"},
+		{"203.0.113.7", "203.0.113.7/32"},
+		{"2001:db8::1", "2001:db8::1/128"},
+		{"203.0.113.300", ""},
+		{"203.0.113.0/33", ""},
+		{"example.com", ""},
+		{"", ""},
+	} {
+		network, err := parseIPRange(test.value)
+		switch {
+		case test.want == "" && err == nil:
+			t.Errorf("parseIPRange(%q) accepted %v", test.value, network)
+		case test.want != "" && err != nil:
+			t.Errorf("parseIPRange(%q): %v", test.value, err)
+		case test.want != "" && network.String() != test.want:
+			t.Errorf("parseIPRange(%q) = %v, want %s", test.value, network, test.want)
+		}
+	}
+}
+
+func TestPermitsRange(t *testing.T) {
+	allowlist := NetworkAllowlist{}
+	for _, value := range []string{"203.0.113.0/24", "198.51.100.10", "2001:db8::/32"} {
+		network, err := parseIPRange(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		allowlist.IPRanges = append(allowlist.IPRanges, network)
+	}
+
+	for _, test := range []struct {
+		value string
+		want  bool
+	}{
+		{"203.0.113.0/24", true},
+		{"203.0.113.128/25", true},
+		{"203.0.113.9", true},
+		{"203.0.112.0/23", false}, // contains the approved range but is wider
+		{"192.0.2.0/24", false},
+		{"198.51.100.10", true},
+		{"198.51.100.11", false},
+		{"198.51.100.0/24", false},
+		{"2001:db8:1::/48", true},
+		{"2001:db9::/48", false},
+	} {
+		network, err := parseIPRange(test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := allowlist.permitsRange(network); got != test.want {
+			t.Errorf("permitsRange(%s) = %t, want %t", test.value, got, test.want)
+		}
+	}
+}
+
+func TestLoadNetworkAllowlist(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Reset()
+	allowlist, err := LoadNetworkAllowlist()
+	if err != nil || strings.Join(allowlist.Bypass, ",") != "AzureServices,Logging,Metrics" {
+		t.Errorf("default bypass %v, %v", allowlist.Bypass, err)
+	}
+
+	viper.Set("raids.ABS.network.allowlist.bypass", []string{})
+	viper.Set("raids.ABS.network.allowlist.ip_ranges", []string{"203.0.113.0/24", "198.51.100.10"})
+	allowlist, err = LoadNetworkAllowlist()
+	if err != nil || len(allowlist.Bypass) != 0 || len(allowlist.IPRanges) != 2 {
+		t.Errorf("loaded %+v, %v", allowlist, err)
+	}
+
+	viper.Set("raids.ABS.network.allowlist.ip_ranges", []string{"203.0.113.0/24", "203.0.113.0/40"})
+	if _, err := LoadNetworkAllowlist(); err == nil || !strings.Contains(err.Error(), "ip_ranges") {
+		t.Errorf("expected the malformed range to be rejected, got %v", err)
+	}
+}
+
+func TestNetworkAllowlistReview(t *testing.T) {
+	subnet := "/subscriptions/sub-a/resourceGroups/rg-net/providers/Microsoft.Network/virtualNetworks/vnet/subnets/data"
+	endpoint := "/subscriptions/sub-a/resourceGroups/rg-net/providers/Microsoft.Network/privateEndpoints/"
+	_, approvedRange, _ := net.ParseCIDR("203.0.113.0/24")
+	allowlist := NetworkAllowlist{
+		IPRanges:         []*net.IPNet{approvedRange},
+		VirtualNetworks:  []string{subnet},
+		Resources:        []string{"/subscriptions/sub-a/providers/Microsoft.Synapse/workspaces/approved"},
+		PrivateEndpoints: []string{endpoint + "approved"},
+		Bypass:           []string{"AzureServices"},
+	}
+	connections := `"privateEndpointConnections":[
+		{"properties":{"privateEndpoint":{"id":"` + endpoint + `approved"},"privateLinkServiceConnectionState":{"status":"Approved"}}},
+		{"properties":{"privateEndpoint":{"id":"` + endpoint + `rogue"},"privateLinkServiceConnectionState":{"status":"Approved"}}},
+		{"properties":{"privateEndpoint":{"id":"` + endpoint + `pending"},"privateLinkServiceConnectionState":{"status":"Pending"}}},
+		{"properties":{"privateEndpoint":{"id":"` + endpoint + `rejected"},"privateLinkServiceConnectionState":{"status":"Rejected"}}}]`
+
+	for name, test := range map[string]struct {
+		properties string
+		approved   []string
+		unapproved []string
+	}{
+		"default action allow": {
+			properties: `"networkAcls":{"defaultAction":"Allow","bypass":"None"}`,
+			unapproved: []string{"default action allows every public address"},
+		},
+		"ip rules": {
+			properties: `"networkAcls":{"defaultAction":"Deny","bypass":"None","ipRules":[
+				{"value":"203.0.113.64/26"},{"value":"203.0.113.9"},{"value":"192.0.2.0/24"},{"value":"203.0.113.0/40"}]}`,
+			approved:   []string{"default action Deny", "IP range 203.0.113.64/26", "IP range 203.0.113.9"},
+			unapproved: []string{"IP range 192.0.2.0/24", `unparseable IP rule "203.0.113.0/40"`},
+		},
+		"subnets and resources": {
+			properties: `"networkAcls":{"defaultAction":"Deny","bypass":"None",
+				"virtualNetworkRules":[{"id":"` + strings.ToUpper(subnet) + `"},{"id":"` + subnet + `-other"}],
+				"resourceAccessRules":[{"tenantId":"tenant-a","resourceId":"/subscriptions/sub-a/providers/Microsoft.Synapse/workspaces/approved"},
+					{"tenantId":"tenant-b","resourceId":"/subscriptions/sub-b/providers/Microsoft.Synapse/workspaces/other"}]}`,
+			approved: []string{"default action Deny", "subnet " + strings.ToUpper(subnet),
+				"resource /subscriptions/sub-a/providers/Microsoft.Synapse/workspaces/approved"},
+			unapproved: []string{"subnet " + subnet + "-other",
+				"resource /subscriptions/sub-b/providers/Microsoft.Synapse/workspaces/other in tenant tenant-b"},
+		},
+		"bypass": {
+			properties: `"networkAcls":{"defaultAction":"Deny","bypass":"AzureServices, Logging,Metrics"}`,
+			approved:   []string{"default action Deny", "bypass AzureServices"},
+			unapproved: []string{"bypass Logging", "bypass Metrics"},
+		},
+		"public network access disabled": {
+			properties: `"publicNetworkAccess":"Disabled","networkAcls":{"defaultAction":"Allow","bypass":"Logging","ipRules":[{"value":"192.0.2.0/24"}]}`,
+			approved:   []string{"public network access disabled"},
+		},
+		"private endpoints": {
+			properties: `"publicNetworkAccess":"Disabled",` + connections,
+			approved:   []string{"public network access disabled", "private endpoint " + endpoint + "approved"},
+			unapproved: []string{"private endpoint " + endpoint + "rogue"},
+		},
+	} {
+		var account StorageAccount
+		if err := json.Unmarshal([]byte(`{"properties":{`+test.properties+`}}`), &account); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		approved, unapproved := allowlist.Review(&account)
+		if strings.Join(approved, "\n") != strings.Join(test.approved, "\n") {
+			t.Errorf("%s: approved %q, want %q", name, approved, test.approved)
+		}
+		if strings.Join(unapproved, "\n") != strings.Join(test.unapproved, "\n") {
+			t.Errorf("%s: unapproved %q, want %q", name, unapproved, test.unapproved)
+		}
+	}
+}
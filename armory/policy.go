@@ -0,0 +1,223 @@
+package armory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// API versions used for Azure Policy and deployment validation requests
+const (
+	policyAPIVersion      = "2022-06-01"
+	policySetAPIVersion   = "2021-06-01"
+	deploymentsAPIVersion = "2021-04-01"
+)
+
+// Built-in "Allowed locations" policy definition
+const allowedLocationsPolicy = "e56962a6-4747-49cd-b67b-bf8b01975c4c"
+
+// RegionPolicy holds the regions data may be stored in, read from raids.ABS.regions
+type RegionPolicy struct {
+	Allowed                []string // When set, every region must be listed here
+	Denied                 []string
+	VerifyDeniedDeployment bool // Validate a deployment to a denied region and expect it to be refused
+}
+
+// LoadRegionPolicy reads raids.ABS.regions
+func LoadRegionPolicy() RegionPolicy {
+	policy := RegionPolicy{VerifyDeniedDeployment: viper.GetBool("raids.ABS.regions.verify_denied_deployment")}
+	for _, region := range viper.GetStringSlice("raids.ABS.regions.allowed") {
+		policy.Allowed = append(policy.Allowed, NormalizeRegion(region))
+	}
+	for _, region := range viper.GetStringSlice("raids.ABS.regions.denied") {
+		policy.Denied = append(policy.Denied, NormalizeRegion(region))
+	}
+	return policy
+}
+
+// NormalizeRegion turns display names such as "East US 2" into region names such as eastus2
+func NormalizeRegion(region string) string {
+	return strings.ToLower(strings.ReplaceAll(region, " ", ""))
+}
+
+// Permits reports whether data may be stored in region
+func (p RegionPolicy) Permits(region string) bool {
+	region = NormalizeRegion(region)
+	if containsFold(p.Denied, region) {
+		return false
+	}
+	return len(p.Allowed) == 0 || containsFold(p.Allowed, region)
+}
+
+// PolicyAssignment is a Microsoft.Authorization/policyAssignments resource
+type PolicyAssignment struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Properties struct {
+		DisplayName        string   `json:"displayName"`
+		PolicyDefinitionID string   `json:"policyDefinitionId"`
+		Scope              string   `json:"scope"`
+		NotScopes          []string `json:"notScopes"`
+		EnforcementMode    string   `json:"enforcementMode"` // Default or DoNotEnforce
+		Parameters         map[string]struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"parameters"`
+	} `json:"properties"`
+}
+
+// ListPolicyAssignments returns the policy assignments that apply at scope, including those inherited from above
+func (c *ARMClient) ListPolicyAssignments(ctx context.Context, scope string) ([]PolicyAssignment, error) {
+	var assignments []PolicyAssignment
+	err := c.List(ctx, scope+"/providers/Microsoft.Authorization/policyAssignments?$filter=atScope()", policyAPIVersion, func(item json.RawMessage) error {
+		var assignment PolicyAssignment
+		if err := json.Unmarshal(item, &assignment); err != nil {
+			return err
+		}
+		assignments = append(assignments, assignment)
+		return nil
+	})
+	return assignments, err
+}
+
+// policySetMember is a policy definition referenced from an initiative
+type policySetMember struct {
+	PolicyDefinitionID string `json:"policyDefinitionId"`
+	Parameters         map[string]struct {
+		Value json.RawMessage `json:"value"`
+	} `json:"parameters"`
+}
+
+// PolicySet is the subset of a Microsoft.Authorization/policySetDefinitions resource read by the raid
+type PolicySet struct {
+	Properties struct {
+		PolicyDefinitions []policySetMember `json:"policyDefinitions"`
+		Parameters        map[string]struct {
+			DefaultValue json.RawMessage `json:"defaultValue"`
+		} `json:"parameters"`
+	} `json:"properties"`
+}
+
+// GetPolicySet reads the initiative with the given resource ID
+func (c *ARMClient) GetPolicySet(ctx context.Context, policySetID string) (*PolicySet, error) {
+	set := &PolicySet{}
+	if err := c.Get(ctx, policySetID, policySetAPIVersion, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// AllowedLocationsAssignment describes an enforced "Allowed locations" policy covering a resource
+type AllowedLocationsAssignment struct {
+	Name      string
+	Scope     string
+	Locations []string // Empty when the assignment lists no locations or they could not be resolved
+}
+
+// FindAllowedLocations returns every enforced assignment of the built-in "Allowed locations" policy, directly or
+// through an initiative, that covers resourceID
+func (c *ARMClient) FindAllowedLocations(ctx context.Context, resourceID string) ([]AllowedLocationsAssignment, error) {
+	assignments, err := c.ListPolicyAssignments(ctx, resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []AllowedLocationsAssignment
+	for _, assignment := range assignments {
+		properties := assignment.Properties
+		if strings.EqualFold(properties.EnforcementMode, "DoNotEnforce") || excludes(properties.NotScopes, resourceID) {
+			continue
+		}
+		name := properties.DisplayName
+		if name == "" {
+			name = assignment.Name
+		}
+
+		definition := strings.ToLower(properties.PolicyDefinitionID)
+		if strings.HasSuffix(definition, allowedLocationsPolicy) {
+			found = append(found, AllowedLocationsAssignment{
+				Name:      name,
+				Scope:     properties.Scope,
+				Locations: parameterLocations(properties.Parameters["listOfAllowedLocations"].Value),
+			})
+			continue
+		}
+		if !strings.Contains(definition, "/policysetdefinitions/") {
+			continue
+		}
+		set, err := c.GetPolicySet(ctx, properties.PolicyDefinitionID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read initiative %s: %v", name, err)
+		}
+		for _, member := range set.Properties.PolicyDefinitions {
+			if !strings.HasSuffix(strings.ToLower(member.PolicyDefinitionID), allowedLocationsPolicy) {
+				continue
+			}
+			// members usually forward an initiative parameter, written as [parameters('name')],
+			// which takes the initiative's default when the assignment does not set it
+			value := member.Parameters["listOfAllowedLocations"].Value
+			var reference string
+			if json.Unmarshal(value, &reference) == nil && strings.HasPrefix(reference, "[parameters('") {
+				parameter := strings.TrimSuffix(strings.TrimPrefix(reference, "[parameters('"), "')]")
+				value = properties.Parameters[parameter].Value
+				if len(value) == 0 {
+					value = set.Properties.Parameters[parameter].DefaultValue
+				}
+			}
+			found = append(found, AllowedLocationsAssignment{Name: name, Scope: properties.Scope, Locations: parameterLocations(value)})
+		}
+	}
+	return found, nil
+}
+
+func parameterLocations(value json.RawMessage) []string {
+	var locations []string
+	_ = json.Unmarshal(value, &locations)
+	return locations
+}
+
+// excludes reports whether resourceID falls under one of the excluded scopes
+func excludes(notScopes []string, resourceID string) bool {
+	for _, scope := range notScopes {
+		if strings.HasPrefix(strings.ToLower(resourceID)+"/", strings.ToLower(strings.TrimSuffix(scope, "/"))+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateStorageDeployment asks ARM to validate, without deploying, a storage account in region within the resource group.
+// It returns nil when the deployment would be accepted.
+func (c *ARMClient) ValidateStorageDeployment(ctx context.Context, subscriptionID, resourceGroup, accountName, region string) error {
+	template := map[string]interface{}{
+		"$schema":        "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+		"contentVersion": "1.0.0.0",
+		"resources": []map[string]interface{}{{
+			"type":       "Microsoft.Storage/storageAccounts",
+			"apiVersion": storageAPIVersion,
+			"name":       accountName,
+			"location":   region,
+			"kind":       "StorageV2",
+			"sku":        map[string]string{"name": "Standard_LRS"},
+		}},
+	}
+	body := map[string]interface{}{
+		"properties": map[string]interface{}{"mode": "Incremental", "template": template},
+	}
+	path := fmt.Sprintf("/subscriptions/%s/resourcegroups/%s/providers/Microsoft.Resources/deployments/%s/validate",
+		subscriptionID, resourceGroup, accountName)
+	return c.Do(ctx, http.MethodPost, c.resourceURL(path, deploymentsAPIVersion), body, nil)
+}
+
+// disallowedByPolicy reports whether err is ARM refusing a request because of an Azure Policy assignment
+func disallowedByPolicy(err error) bool {
+	var armErr *ARMError
+	if !errors.As(err, &armErr) {
+		return false
+	}
+	return armErr.Code == "RequestDisallowedByPolicy" || containsFold(armErr.Details, "RequestDisallowedByPolicy")
+}
@@ -0,0 +1,68 @@
+package armory
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const allowedLocationsDefinition = "/providers/Microsoft.Authorization/policyDefinitions/" + allowedLocationsPolicy
+
+func TestFindAllowedLocationsResolvesParameters(t *testing.T) {
+	target := recordedTarget()
+	_, arm := newFakeARM(t, map[string]string{
+		"GET " + target.ResourceID() + "/providers/Microsoft.Authorization/policyAssignments": `{"value":[
+			{"name":"direct","properties":{"displayName":"Direct","scope":"/subscriptions/sub-a","policyDefinitionId":"` + allowedLocationsDefinition + `",
+			 "parameters":{"listOfAllowedLocations":{"value":["westeurope","northeurope"]}}}},
+			{"name":"audit-only","properties":{"scope":"/subscriptions/sub-a","policyDefinitionId":"` + allowedLocationsDefinition + `","enforcementMode":"DoNotEnforce",
+			 "parameters":{"listOfAllowedLocations":{"value":["eastus"]}}}},
+			{"name":"defaulted","properties":{"displayName":"Defaulted","scope":"/providers/Microsoft.Management/managementGroups/root",
+			 "policyDefinitionId":"/providers/Microsoft.Authorization/policySetDefinitions/baseline"}},
+			{"name":"unresolved","properties":{"displayName":"Unresolved","scope":"/subscriptions/sub-a",
+			 "policyDefinitionId":"/providers/Microsoft.Authorization/policySetDefinitions/bare"}}
+		]}`,
+		"GET /providers/Microsoft.Authorization/policySetDefinitions/baseline": `{"properties":{
+			"parameters":{"regions":{"defaultValue":["westeurope"]}},
+			"policyDefinitions":[{"policyDefinitionId":"` + allowedLocationsDefinition + `","parameters":{"listOfAllowedLocations":{"value":"[parameters('regions')]"}}}]}}`,
+		"GET /providers/Microsoft.Authorization/policySetDefinitions/bare": `{"properties":{
+			"parameters":{"regions":{}},
+			"policyDefinitions":[{"policyDefinitionId":"` + allowedLocationsDefinition + `","parameters":{"listOfAllowedLocations":{"value":"[parameters('regions')]"}}}]}}`,
+	})
+
+	assignments, err := arm.FindAllowedLocations(context.Background(), target.ResourceID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, assignment := range assignments {
+		got[assignment.Name] = strings.Join(assignment.Locations, ",")
+	}
+	want := map[string]string{"Direct": "westeurope,northeurope", "Defaulted": "westeurope", "Unresolved": ""}
+	if len(got) != len(want) {
+		t.Errorf("found %v, want %v", got, want)
+	}
+	for name, locations := range want {
+		if value, ok := got[name]; !ok || value != locations {
+			t.Errorf("%s resolved to %q, want %q", name, value, locations)
+		}
+	}
+}
+
+func TestRegionMovementFailsUnresolvedLocations(t *testing.T) {
+	target := recordedTarget()
+	_, arm := newFakeARM(t, map[string]string{
+		"GET " + target.ResourceID(): recordedFixture(t, "storage-account.json"),
+		"GET " + target.ResourceID() + "/providers/Microsoft.Authorization/policyAssignments": `{"value":[
+			{"name":"empty","properties":{"displayName":"Empty","scope":"/subscriptions/sub-a","policyDefinitionId":"` + allowedLocationsDefinition + `",
+			 "parameters":{"listOfAllowedLocations":{"value":[]}}}}]}`,
+	})
+	viper.Set("raids.ABS.regions.allowed", []string{"westeurope", "northeurope"})
+	t.Cleanup(viper.Reset)
+
+	result := (&ABS{ARM: arm}).CCC_C06_TR01_T01(target)
+	if result.Passed || !strings.Contains(result.Message, "Allowed locations assignment Empty at /subscriptions/sub-a lists no locations") {
+		t.Errorf("passed=%t %s", result.Passed, result.Message)
+	}
+}
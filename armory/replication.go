@@ -0,0 +1,258 @@
+package armory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Version of the Data Protection API used to find Azure Backup vaults protecting an account
+const dataProtectionAPIVersion = "2023-05-01"
+
+// DataLocation is a place a storage account's data is copied to, and the region it lands in
+type DataLocation struct {
+	Kind       string // For example "paired secondary" or "object replication destination"
+	Name       string
+	Region     string // Empty when the region could not be determined
+	Unresolved string // Why the region could not be determined
+}
+
+func (l DataLocation) String() string {
+	region := l.Region
+	if region == "" {
+		region = "an unknown region"
+	}
+	return fmt.Sprintf("%s %s in %s", l.Kind, l.Name, region)
+}
+
+// ObjectReplicationPolicy is a Microsoft.Storage/storageAccounts/objectReplicationPolicies resource
+type ObjectReplicationPolicy struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Properties struct {
+		PolicyID           string `json:"policyId"`
+		EnabledTime        string `json:"enabledTime"`
+		SourceAccount      string `json:"sourceAccount"`      // Resource ID, or account name when cross-tenant replication is allowed
+		DestinationAccount string `json:"destinationAccount"` // Resource ID, or account name when cross-tenant replication is allowed
+		Rules              []struct {
+			RuleID               string `json:"ruleId"`
+			SourceContainer      string `json:"sourceContainer"`
+			DestinationContainer string `json:"destinationContainer"`
+		} `json:"rules"`
+	} `json:"properties"`
+}
+
+// ListObjectReplicationPolicies returns the object replication policies in which the account is source or destination
+func (c *ARMClient) ListObjectReplicationPolicies(ctx context.Context, target *Target) ([]ObjectReplicationPolicy, error) {
+	var policies []ObjectReplicationPolicy
+	err := c.List(ctx, target.ResourceID()+"/objectReplicationPolicies", storageAPIVersion, func(item json.RawMessage) error {
+		var policy ObjectReplicationPolicy
+		if err := json.Unmarshal(item, &policy); err != nil {
+			return err
+		}
+		policies = append(policies, policy)
+		return nil
+	})
+	return policies, err
+}
+
+// FindBackupVaults returns the Azure Backup vaults holding a backup instance of resourceID.
+// A vault may protect resources in other subscriptions, so every subscription the credential can read is searched,
+// starting with subscriptionID; a subscription that cannot be searched fails the lookup rather than being skipped.
+func (c *ARMClient) FindBackupVaults(ctx context.Context, subscriptionID, resourceID string) ([]DataLocation, error) {
+	others, err := c.otherSubscriptions(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	filter := "resourceType eq 'Microsoft.DataProtection/backupVaults'"
+
+	type vault struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Location string `json:"location"`
+	}
+	var vaults []vault
+	for _, subscription := range append([]string{subscriptionID}, others...) {
+		path := fmt.Sprintf("/subscriptions/%s/resources?$filter=%s", subscription, url.QueryEscape(filter))
+		err := c.List(ctx, path, resourcesAPIVersion, func(item json.RawMessage) error {
+			var found vault
+			if err := json.Unmarshal(item, &found); err != nil {
+				return err
+			}
+			vaults = append(vaults, found)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to search subscription %s for backup vaults: %v", subscription, err)
+		}
+	}
+
+	var locations []DataLocation
+	for _, candidate := range vaults {
+		protects := false
+		err := c.List(ctx, candidate.ID+"/backupInstances", dataProtectionAPIVersion, func(item json.RawMessage) error {
+			var instance struct {
+				Properties struct {
+					DataSourceInfo struct {
+						ResourceID string `json:"resourceID"`
+					} `json:"dataSourceInfo"`
+				} `json:"properties"`
+			}
+			if err := json.Unmarshal(item, &instance); err != nil {
+				return err
+			}
+			if strings.EqualFold(instance.Properties.DataSourceInfo.ResourceID, resourceID) {
+				protects = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list backup instances in vault %s: %v", candidate.Name, err)
+		}
+		if protects {
+			locations = append(locations, DataLocation{Kind: "backup vault", Name: candidate.Name, Region: candidate.Location})
+		}
+	}
+	return locations, nil
+}
+
+// DataLocations enumerates every place the account's data lands besides its primary region:
+// the geo-redundant secondary, object replication destinations and Azure Backup vaults
+func (c *ARMClient) DataLocations(ctx context.Context, target *Target, account *StorageAccount) ([]DataLocation, error) {
+	var locations []DataLocation
+	if account.Properties.SecondaryLocation != "" {
+		locations = append(locations, DataLocation{
+			Kind:   "paired secondary",
+			Name:   account.Sku.Name,
+			Region: account.Properties.SecondaryLocation,
+		})
+	}
+
+	policies, err := c.ListObjectReplicationPolicies(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list object replication policies: %v", err)
+	}
+	for _, policy := range policies {
+		destination := policy.Properties.DestinationAccount
+		if strings.EqualFold(destination, account.ID) || strings.EqualFold(destination, account.Name) {
+			continue
+		}
+		location := DataLocation{Kind: "object replication destination", Name: destination}
+		if strings.HasPrefix(destination, "/") {
+			var replica StorageAccount
+			if err := c.Get(ctx, destination, storageAPIVersion, &replica); err != nil {
+				location.Name = resourceName(destination)
+				location.Unresolved = fmt.Sprintf("unable to read %s: %v", destination, err)
+			} else {
+				location.Name, location.Region = replica.Name, replica.Location
+			}
+		} else {
+			// cross-tenant replication names the destination account without its resource ID
+			location.Unresolved = "the destination is named without a resource ID, so its region cannot be read"
+		}
+		locations = append(locations, location)
+	}
+
+	vaults, err := c.FindBackupVaults(ctx, target.SubscriptionID, account.ID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find backup vaults: %v", err)
+	}
+	return append(locations, vaults...), nil
+}
+
+// Redundancy describes how a storage account SKU copies data
+type Redundancy struct {
+	Name              string // LRS, ZRS, GRS, RA-GRS, GZRS or RA-GZRS
+	ZoneRedundant     bool   // Copies are spread across availability zones in the primary region
+	GeoRedundant      bool   // Copies are kept in a secondary region
+	ReadableSecondary bool   // The secondary region serves reads
+}
+
+// redundancies lists every redundancy option by the suffix used in SKU names such as Standard_RAGZRS
+var redundancies = map[string]Redundancy{
+	"LRS":    {Name: "LRS"},
+	"ZRS":    {Name: "ZRS", ZoneRedundant: true},
+	"GRS":    {Name: "GRS", GeoRedundant: true},
+	"RAGRS":  {Name: "RA-GRS", GeoRedundant: true, ReadableSecondary: true},
+	"GZRS":   {Name: "GZRS", ZoneRedundant: true, GeoRedundant: true},
+	"RAGZRS": {Name: "RA-GZRS", ZoneRedundant: true, GeoRedundant: true, ReadableSecondary: true},
+}
+
+// ParseRedundancy classifies a SKU name such as Premium_ZRS, or a redundancy name such as RA-GZRS
+func ParseRedundancy(name string) (Redundancy, bool) {
+	name = strings.ToUpper(name)
+	if i := strings.LastIndex(name, "_"); i >= 0 {
+		name = name[i+1:]
+	}
+	redundancy, ok := redundancies[strings.ReplaceAll(name, "-", "")]
+	return redundancy, ok
+}
+
+// Meets reports whether r provides at least every property of minimum
+func (r Redundancy) Meets(minimum Redundancy) bool {
+	return (r.ZoneRedundant || !minimum.ZoneRedundant) &&
+		(r.GeoRedundant || !minimum.GeoRedundant) &&
+		(r.ReadableSecondary || !minimum.ReadableSecondary)
+}
+
+// LoadMinimumRedundancy reads raids.ABS.redundancy.minimum. When unset, any option other than LRS is accepted.
+func LoadMinimumRedundancy() (*Redundancy, error) {
+	if !viper.IsSet("raids.ABS.redundancy.minimum") {
+		return nil, nil
+	}
+	value := viper.GetString("raids.ABS.redundancy.minimum")
+	minimum, ok := ParseRedundancy(value)
+	if !ok {
+		return nil, fmt.Errorf("raids.ABS.redundancy.minimum %q is not one of LRS, ZRS, GRS, RA-GRS, GZRS or RA-GZRS", value)
+	}
+	return &minimum, nil
+}
+
+// LoadRecoveryPointObjective reads raids.ABS.redundancy.rpo_minutes, the longest acceptable replication lag, defaulting to 15 minutes
+func LoadRecoveryPointObjective() time.Duration {
+	if viper.IsSet("raids.ABS.redundancy.rpo_minutes") {
+		return time.Duration(viper.GetFloat64("raids.ABS.redundancy.rpo_minutes") * float64(time.Minute))
+	}
+	return 15 * time.Minute
+}
+
+// GeoReplicationStats is the state of replication to the secondary region of a geo-redundant account
+type GeoReplicationStats struct {
+	Status       string    // live, bootstrap or unavailable
+	LastSyncTime time.Time // Zero when no sync has completed yet
+	CanFailover  *bool     // Reported by ARM only
+}
+
+// Lag returns how far the secondary trails now, or false when it has never synced
+func (s *GeoReplicationStats) Lag(now time.Time) (time.Duration, bool) {
+	if s.LastSyncTime.IsZero() {
+		return 0, false
+	}
+	return now.Sub(s.LastSyncTime), true
+}
+
+// GetGeoReplicationStats reads the account's geo-replication statistics through ARM
+func (c *ARMClient) GetGeoReplicationStats(ctx context.Context, target *Target) (*GeoReplicationStats, error) {
+	var account struct {
+		Properties struct {
+			GeoReplicationStats *struct {
+				Status       string    `json:"status"`
+				LastSyncTime time.Time `json:"lastSyncTime"`
+				CanFailover  *bool     `json:"canFailover"`
+			} `json:"geoReplicationStats"`
+		} `json:"properties"`
+	}
+	if err := c.Get(ctx, target.ResourceID()+"?$expand=geoReplicationStats", storageAPIVersion, &account); err != nil {
+		return nil, err
+	}
+	stats := account.Properties.GeoReplicationStats
+	if stats == nil {
+		return nil, fmt.Errorf("no geo-replication statistics were returned")
+	}
+	return &GeoReplicationStats{Status: stats.Status, LastSyncTime: stats.LastSyncTime, CanFailover: stats.CanFailover}, nil
+}
@@ -0,0 +1,208 @@
+package armory
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestFindBackupVaultsSearchesEverySubscription(t *testing.T) {
+	target := recordedTarget()
+	vault := "/subscriptions/sub-backup/resourceGroups/rg-backup/providers/Microsoft.DataProtection/backupVaults/central"
+	_, arm := newFakeARM(t, map[string]string{
+		"GET /subscriptions": `{"value":[{"subscriptionId":"` + target.SubscriptionID + `"},{"subscriptionId":"sub-backup"}]}`,
+		"GET /subscriptions/" + target.SubscriptionID + "/resources": `{"value":[]}`,
+		"GET /subscriptions/sub-backup/resources":                    `{"value":[{"id":"` + vault + `","name":"central","location":"northeurope"}]}`,
+		"GET " + vault + "/backupInstances":                          `{"value":[{"properties":{"dataSourceInfo":{"resourceID":"` + strings.ToLower(target.ResourceID()) + `"}}}]}`,
+	})
+
+	locations, err := arm.FindBackupVaults(context.Background(), target.SubscriptionID, target.ResourceID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 || locations[0].Name != "central" || locations[0].Region != "northeurope" {
+		t.Errorf("found %+v, want the vault in sub-backup", locations)
+	}
+}
+
+func TestFindBackupVaultsReportsUnsearchedSubscriptions(t *testing.T) {
+	target := recordedTarget()
+	_, arm := newFakeARM(t, map[string]string{
+		"GET /subscriptions": `{"value":[{"subscriptionId":"` + target.SubscriptionID + `"},{"subscriptionId":"sub-locked"}]}`,
+		"GET /subscriptions/" + target.SubscriptionID + "/resources": `{"value":[]}`,
+	})
+	_, err := arm.FindBackupVaults(context.Background(), target.SubscriptionID, target.ResourceID())
+	if err == nil || !strings.Contains(err.Error(), "unable to search subscription sub-locked") {
+		t.Errorf("expected the unreadable subscription to fail the search, got %v", err)
+	}
+}
+
+func TestReplicationStatusMovement(t *testing.T) {
+	target := recordedTarget()
+	lastSync := time.Now().Add(-40 * time.Minute).UTC()
+	blob, client := newFakeBlobService(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("comp") {
+		case "stats":
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><StorageServiceStats><GeoReplication>` +
+				`<Status>live</Status><LastSyncTime>` + lastSync.Format(http.TimeFormat) + `</LastSyncTime>` +
+				`</GeoReplication></StorageServiceStats>`))
+		case "list":
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>` +
+				`<Blob><Name>a.txt</Name><OrMetadata><Or-policy-1_rule-1>complete</Or-policy-1_rule-1></OrMetadata></Blob>` +
+				`<Blob><Name>b.txt</Name><OrMetadata><Or-policy-1_rule-1>failed</Or-policy-1_rule-1></OrMetadata></Blob>` +
+				`</Blobs><NextMarker/></EnumerationResults>`))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	})
+	target.Endpoints.Blob = blob.URL
+	_, arm := newFakeARM(t, map[string]string{
+		"GET " + target.ResourceID(): `{"id":"` + target.ResourceID() + `","name":"` + target.AccountName + `","sku":{"name":"Standard_RAGRS"},` +
+			`"properties":{"secondaryLocation":"northeurope","secondaryEndpoints":{"blob":"` + blob.URL + `/"},` +
+			`"geoReplicationStats":{"status":"live","lastSyncTime":"` + lastSync.Format(time.RFC3339) + `","canFailover":true}}}`,
+		"GET " + target.ResourceID() + "/objectReplicationPolicies": `{"value":[{"name":"policy-1","properties":{"policyId":"policy-1",` +
+			`"sourceAccount":"` + target.ResourceID() + `","destinationAccount":"/subscriptions/sub-dr/resourceGroups/rg-dr/providers/Microsoft.Storage/storageAccounts/replica",` +
+			`"rules":[{"ruleId":"rule-1","sourceContainer":"data","destinationContainer":"data"}]}}]}`,
+	})
+	viper.Set("raids.ABS.redundancy.rpo_minutes", 60)
+	t.Cleanup(viper.Reset)
+	abs := &ABS{ARM: arm, Credential: staticCredential{}, HTTPClient: client.HTTPClient}
+
+	result := abs.CCC_ObjStor_C08_TR02_T01(target)
+	if result.Passed {
+		t.Errorf("passed with a failed object replication: %s", result.Message)
+	}
+	for _, want := range []string{
+		"rule rule-1 copied 1 of 2 blobs in data to replica, 0 pending, 1 failed: b.txt",
+		"ARM reports status live and a last sync 40m",
+		"secondary endpoint reports status live and a last sync 40m",
+		"failover to northeurope possible: true",
+	} {
+		if !strings.Contains(result.Message, want) {
+			t.Errorf("message %q does not contain %q", result.Message, want)
+		}
+	}
+
+	viper.Set("raids.ABS.redundancy.rpo_minutes", 15)
+	result = abs.CCC_ObjStor_C08_TR02_T01(target)
+	if !strings.Contains(result.Message, "secondary endpoint reports status live and a last sync 40m") || !strings.Contains(result.Message, "beyond the 15m0s RPO") {
+		t.Errorf("expected the lag to exceed the RPO: %s", result.Message)
+	}
+}
+
+func TestParseRedundancy(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		want string // Empty when name must not be recognized
+		zone bool
+		geo  bool
+		read bool
+	}{
+		{"Standard_LRS", "LRS", false, false, false},
+		{"Premium_ZRS", "ZRS", true, false, false},
+		{"Standard_GRS", "GRS", false, true, false},
+		{"RA-GRS", "RA-GRS", false, true, true},
+		{"Standard_RAGRS", "RA-GRS", false, true, true},
+		{"standard_gzrs", "GZRS", true, true, false},
+		{"Standard_RAGZRS", "RA-GZRS", true, true, true},
+		{"RA-GZRS", "RA-GZRS", true, true, true},
+		{"Standard_XRS", "", false, false, false},
+		{"Premium", "", false, false, false},
+		{"", "", false, false, false},
+	} {
+		redundancy, ok := ParseRedundancy(test.name)
+		switch {
+		case ok != (test.want != ""):
+			t.Errorf("ParseRedundancy(%q) recognized=%t", test.name, ok)
+		case ok && (redundancy.Name != test.want || redundancy.ZoneRedundant != test.zone ||
+			redundancy.GeoRedundant != test.geo || redundancy.ReadableSecondary != test.read):
+			t.Errorf("ParseRedundancy(%q) = %+v", test.name, redundancy)
+		}
+	}
+}
+
+func TestRedundancyMovement(t *testing.T) {
+	target := recordedTarget()
+	t.Cleanup(viper.Reset)
+	for _, test := range []struct {
+		sku     string
+		minimum string
+		passed  bool
+		message string
+	}{
+		{"Standard_LRS", "", false, "LRS keeps every copy in a single datacenter"},
+		{"Standard_LRS", "LRS", false, "LRS keeps every copy in a single datacenter"},
+		{"Standard_GRS", "", true, "SKU Standard_GRS is GRS"},
+		{"Standard_GRS", "ZRS", false, "GRS does not meet the required minimum of ZRS"},
+		{"Standard_RAGRS", "GZRS", false, "RA-GRS does not meet the required minimum of GZRS"},
+		{"Premium_ZRS", "ZRS", true, "SKU Premium_ZRS is ZRS"},
+		{"Standard_GZRS", "RA-GRS", false, "GZRS does not meet the required minimum of RA-GRS"},
+		{"Standard_RAGZRS", "GZRS", true, "secondary region northeurope is available and readable"},
+		{"Standard_ZRS", "XRS", false, `raids.ABS.redundancy.minimum "XRS" is not one of`},
+		{"Standard_XRS", "", false, "SKU Standard_XRS has an unrecognized redundancy option"},
+	} {
+		_, arm := newFakeARM(t, map[string]string{
+			"GET " + target.ResourceID(): `{"id":"` + target.ResourceID() + `","location":"westeurope","sku":{"name":"` + test.sku + `"},` +
+				`"properties":{"secondaryLocation":"northeurope","statusOfSecondary":"available"}}`,
+		})
+		viper.Reset()
+		if test.minimum != "" {
+			viper.Set("raids.ABS.redundancy.minimum", test.minimum)
+		}
+
+		result := (&ABS{ARM: arm}).CCC_C08_TR01_T01(target)
+		if result.Passed != test.passed || !strings.Contains(result.Message, test.message) {
+			t.Errorf("%s with minimum %q: passed=%t %s", test.sku, test.minimum, result.Passed, result.Message)
+		}
+	}
+}
+
+func TestDataResidencyMovement(t *testing.T) {
+	target := recordedTarget()
+	replica := "/subscriptions/sub-dr/resourceGroups/rg-dr/providers/Microsoft.Storage/storageAccounts/replica"
+	missing := "/subscriptions/sub-dr/resourceGroups/rg-dr/providers/Microsoft.Storage/storageAccounts/gone"
+	vault := "/subscriptions/" + target.SubscriptionID + "/resourceGroups/rg-backup/providers/Microsoft.DataProtection/backupVaults/vault"
+	policy := func(destination string) string {
+		return `{"name":"` + resourceName(destination) + `","properties":{"sourceAccount":"` + target.ResourceID() + `","destinationAccount":"` + destination + `"}}`
+	}
+	fixtures := func(account, policies string) map[string]string {
+		return map[string]string{
+			"GET " + target.ResourceID(): `{"id":"` + target.ResourceID() + `","name":"` + target.AccountName + `","location":"westeurope",` +
+				`"sku":{"name":"Standard_GRS"},"properties":` + account + `}`,
+			"GET " + target.ResourceID() + "/objectReplicationPolicies": `{"value":[` + policies + `]}`,
+			"GET " + replica:     `{"name":"replica","location":"eastus"}`,
+			"GET /subscriptions": `{"value":[{"subscriptionId":"` + target.SubscriptionID + `"}]}`,
+			"GET /subscriptions/" + target.SubscriptionID + "/resources": `{"value":[{"id":"` + vault + `","name":"vault","location":"westeurope"}]}`,
+			"GET " + vault + "/backupInstances":                          `{"value":[{"properties":{"dataSourceInfo":{"resourceID":"` + target.ResourceID() + `"}}}]}`,
+		}
+	}
+	viper.Set("raids.ABS.regions.allowed", []string{"westeurope", "northeurope"})
+	t.Cleanup(viper.Reset)
+
+	_, arm := newFakeARM(t, fixtures(`{"secondaryLocation":"northeurope","failoverInProgress":true}`, ""))
+	result := (&ABS{ARM: arm}).CCC_C06_TR02_T01(target)
+	if !result.Passed || !strings.Contains(result.Message, "failover to northeurope is in progress") ||
+		!strings.Contains(result.Message, "paired secondary Standard_GRS in northeurope") || !strings.Contains(result.Message, "backup vault vault in westeurope") {
+		t.Errorf("passed=%t %s", result.Passed, result.Message)
+	}
+
+	_, arm = newFakeARM(t, fixtures(`{"secondaryLocation":"northeurope","lastGeoFailoverTime":"2026-09-01T10:00:00Z"}`, policy(replica)+","+policy(missing)))
+	result = (&ABS{ARM: arm}).CCC_C06_TR02_T01(target)
+	if result.Passed {
+		t.Errorf("replication to a restricted region passed: %s", result.Message)
+	}
+	for _, want := range []string{
+		"object replication destination replica in eastus is a restricted region",
+		"object replication destination gone in an unknown region could not be verified: unable to read " + missing,
+		"ResourceNotFound",
+		"last failed over at 2026-09-01T10:00:00Z",
+	} {
+		if !strings.Contains(result.Message, want) {
+			t.Errorf("message %q does not contain %q", result.Message, want)
+		}
+	}
+}
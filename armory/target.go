@@ -0,0 +1,339 @@
+package armory
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// CloudEnvironment holds the per-cloud hostnames used to reach Azure
+type CloudEnvironment struct {
+	Name                    string
+	AuthorityHost           string
+	ResourceManagerEndpoint string
+	ResourceManagerScope    string
+	StorageEndpointSuffix   string
+	StorageScope            string
+	GraphEndpoint           string
+	GraphScope              string
+	LogAnalyticsEndpoint    string
+	LogAnalyticsScope       string
+}
+
+// Clouds lists the supported values for raids.ABS.cloud
+var Clouds = map[string]CloudEnvironment{
+	"azurepubliccloud": {
+		Name:                    "AzurePublicCloud",
+		AuthorityHost:           "https://login.microsoftonline.com",
+		ResourceManagerEndpoint: "https://management.azure.com",
+		ResourceManagerScope:    "https://management.azure.com/.default",
+		StorageEndpointSuffix:   "core.windows.net",
+		StorageScope:            "https://storage.azure.com/.default",
+		GraphEndpoint:           "https://graph.microsoft.com",
+		GraphScope:              "https://graph.microsoft.com/.default",
+		LogAnalyticsEndpoint:    "https://api.loganalytics.io",
+		LogAnalyticsScope:       "https://api.loganalytics.io/.default",
+	},
+	"azureusgovernment": {
+		Name:                    "AzureUSGovernment",
+		AuthorityHost:           "https://login.microsoftonline.us",
+		ResourceManagerEndpoint: "https://management.usgovcloudapi.net",
+		ResourceManagerScope:    "https://management.usgovcloudapi.net/.default",
+		StorageEndpointSuffix:   "core.usgovcloudapi.net",
+		StorageScope:            "https://storage.azure.com/.default",
+		GraphEndpoint:           "https://graph.microsoft.us",
+		GraphScope:              "https://graph.microsoft.us/.default",
+		LogAnalyticsEndpoint:    "https://api.loganalytics.us",
+		LogAnalyticsScope:       "https://api.loganalytics.us/.default",
+	},
+	"azurechinacloud": {
+		Name:                    "AzureChinaCloud",
+		AuthorityHost:           "https://login.chinacloudapi.cn",
+		ResourceManagerEndpoint: "https://management.chinacloudapi.cn",
+		ResourceManagerScope:    "https://management.chinacloudapi.cn/.default",
+		StorageEndpointSuffix:   "core.chinacloudapi.cn",
+		StorageScope:            "https://storage.azure.com/.default",
+		GraphEndpoint:           "https://microsoftgraph.chinacloudapi.cn",
+		GraphScope:              "https://microsoftgraph.chinacloudapi.cn/.default",
+		LogAnalyticsEndpoint:    "https://api.loganalytics.azure.cn",
+		LogAnalyticsScope:       "https://api.loganalytics.azure.cn/.default",
+	},
+}
+
+const defaultCloud = "azurepubliccloud"
+
+// StorageEndpoints are the data-plane URLs of a storage account
+type StorageEndpoints struct {
+	Blob  string
+	DFS   string
+	Queue string
+	Table string
+	File  string
+	Web   string // Static website endpoints include a zone, so this is only known once read from ARM
+}
+
+// ServiceEndpoint pairs a storage service name with its URL
+type ServiceEndpoint struct {
+	Service string
+	URL     string // Empty when the endpoint is not known
+}
+
+// ByService lists every service endpoint in a fixed order
+func (e StorageEndpoints) ByService() []ServiceEndpoint {
+	return []ServiceEndpoint{
+		{"blob", e.Blob},
+		{"dfs", e.DFS},
+		{"queue", e.Queue},
+		{"table", e.Table},
+		{"file", e.File},
+		{"web", e.Web},
+	}
+}
+
+// Target is a single storage account that the raid evaluates
+type Target struct {
+	SubscriptionID string
+	ResourceGroup  string
+	AccountName    string
+	Container      string // Optional, required only by movements that read or write blobs
+	Cloud          CloudEnvironment
+	Endpoints      StorageEndpoints
+	SharedKey      *SharedKeyCredential // Set only in emulator mode, where data-plane requests are signed with the account key
+}
+
+// ResourceID returns the ARM resource ID of the storage account
+func (t *Target) ResourceID() string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Storage/storageAccounts/%s",
+		t.SubscriptionID, t.ResourceGroup, t.AccountName)
+}
+
+// TargetSelection describes which storage accounts the raid evaluates.
+// Accounts may be listed explicitly; otherwise every account in the resource group, or in the whole subscription, is
+// enumerated through ARM. Tags narrow either form down to accounts carrying every listed tag.
+type TargetSelection struct {
+	SubscriptionID string
+	ResourceGroup  string
+	Accounts       []string          // Account names within ResourceGroup, or full storage account resource IDs
+	Tags           map[string]string // Tag names are matched case-insensitively, a value of "*" matches any value
+	Container      string
+	Cloud          CloudEnvironment
+	Emulator       EmulatorConfig
+}
+
+var storageAccountNamePattern = regexp.MustCompile(`^[a-z0-9]{3,24}$`)
+
+// LoadTargetSelection reads and validates the account selection described under raids.ABS
+func LoadTargetSelection() (*TargetSelection, error) {
+	cloudName := strings.ToLower(viper.GetString("raids.ABS.cloud"))
+	if cloudName == "" {
+		cloudName = defaultCloud
+	}
+	cloud, ok := Clouds[cloudName]
+	if !ok {
+		return nil, fmt.Errorf("unknown cloud environment %q in raids.ABS.cloud", viper.GetString("raids.ABS.cloud"))
+	}
+	if endpoint := viper.GetString("raids.ABS.resource_manager_endpoint"); endpoint != "" {
+		cloud.ResourceManagerEndpoint = endpoint
+	}
+	if endpoint := viper.GetString("raids.ABS.graph_endpoint"); endpoint != "" {
+		cloud.GraphEndpoint = endpoint
+	}
+	if endpoint := viper.GetString("raids.ABS.log_analytics_endpoint"); endpoint != "" {
+		cloud.LogAnalyticsEndpoint = endpoint
+	}
+
+	selection := &TargetSelection{
+		SubscriptionID: viper.GetString("raids.ABS.subscription_id"),
+		ResourceGroup:  viper.GetString("raids.ABS.resource_group"),
+		Accounts:       viper.GetStringSlice("raids.ABS.storage_accounts"),
+		Tags:           viper.GetStringMapString("raids.ABS.tags"),
+		Container:      viper.GetString("raids.ABS.container"),
+		Cloud:          cloud,
+		Emulator:       LoadEmulatorConfig(),
+	}
+	if account := viper.GetString("raids.ABS.storage_account"); account != "" {
+		selection.Accounts = append([]string{account}, selection.Accounts...)
+	}
+	if err := selection.validate(); err != nil {
+		return nil, err
+	}
+	return selection, nil
+}
+
+func (s *TargetSelection) validate() error {
+	if s.Emulator.Enabled {
+		return nil
+	}
+	if s.SubscriptionID == "" {
+		return fmt.Errorf("missing required config: raids.ABS.subscription_id")
+	}
+	for _, account := range s.Accounts {
+		if strings.HasPrefix(account, "/") {
+			if _, _, _, err := ResourceIDParts(account); err != nil {
+				return err
+			}
+			continue
+		}
+		if !storageAccountNamePattern.MatchString(account) {
+			return fmt.Errorf("storage account name %q must be 3-24 lowercase letters and numbers", account)
+		}
+		if s.ResourceGroup == "" {
+			return fmt.Errorf("missing required config: raids.ABS.resource_group (needed to locate storage account %q)", account)
+		}
+	}
+	return nil
+}
+
+// Resolve returns a target for every selected account.
+// Explicitly listed accounts are used as-is when no tag selector is set, so no ARM access is needed.
+func (s *TargetSelection) Resolve(ctx context.Context, arm *ARMClient) ([]*Target, error) {
+	if s.Emulator.Enabled {
+		return []*Target{s.emulatorTarget()}, nil
+	}
+	if len(s.Accounts) > 0 && len(s.Tags) == 0 {
+		var targets []*Target
+		for _, account := range s.Accounts {
+			target, err := s.explicitTarget(account)
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, target)
+		}
+		return targets, nil
+	}
+
+	accounts, err := arm.ListStorageAccounts(ctx, s.SubscriptionID, s.ResourceGroup)
+	if err != nil {
+		return nil, fmt.Errorf("unable to enumerate storage accounts: %v", err)
+	}
+	var targets []*Target
+	for _, account := range accounts {
+		if !s.selects(account) {
+			continue
+		}
+		target, err := s.targetFromAccount(account)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no storage accounts matched the selection in subscription %s", s.SubscriptionID)
+	}
+	return targets, nil
+}
+
+func (s *TargetSelection) explicitTarget(account string) (*Target, error) {
+	target := &Target{
+		SubscriptionID: s.SubscriptionID,
+		ResourceGroup:  s.ResourceGroup,
+		AccountName:    account,
+		Container:      s.Container,
+		Cloud:          s.Cloud,
+	}
+	if strings.HasPrefix(account, "/") {
+		var err error
+		target.SubscriptionID, target.ResourceGroup, target.AccountName, err = ResourceIDParts(account)
+		if err != nil {
+			return nil, err
+		}
+	}
+	target.Endpoints = deriveEndpoints(target.AccountName, s.Cloud)
+	return target, nil
+}
+
+// emulatorTarget points the blob endpoint at the emulator and signs data-plane requests with its account key
+func (s *TargetSelection) emulatorTarget() *Target {
+	target := &Target{
+		SubscriptionID: s.SubscriptionID,
+		ResourceGroup:  s.ResourceGroup,
+		AccountName:    s.Emulator.AccountName,
+		Container:      s.Container,
+		Cloud:          s.Cloud,
+		Endpoints:      deriveEndpoints(s.Emulator.AccountName, s.Cloud),
+		SharedKey: &SharedKeyCredential{
+			AccountName: s.Emulator.AccountName,
+			AccountKey:  s.Emulator.AccountKey,
+		},
+	}
+	target.Endpoints.Blob = s.Emulator.BlobEndpoint
+	return target
+}
+
+// selects reports whether an enumerated account is part of the selection
+func (s *TargetSelection) selects(account StorageAccount) bool {
+	if len(s.Accounts) > 0 {
+		listed := false
+		for _, selected := range s.Accounts {
+			if strings.EqualFold(selected, account.Name) || strings.EqualFold(selected, account.ID) {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			return false
+		}
+	}
+	for name, value := range s.Tags {
+		found := false
+		for tagName, tagValue := range account.Tags {
+			if strings.EqualFold(tagName, name) && (value == "*" || tagValue == value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *TargetSelection) targetFromAccount(account StorageAccount) (*Target, error) {
+	subscriptionID, resourceGroup, name, err := ResourceIDParts(account.ID)
+	if err != nil {
+		return nil, err
+	}
+	target := &Target{
+		SubscriptionID: subscriptionID,
+		ResourceGroup:  resourceGroup,
+		AccountName:    name,
+		Container:      s.Container,
+		Cloud:          s.Cloud,
+		Endpoints:      deriveEndpoints(name, s.Cloud),
+	}
+	// prefer the endpoints ARM reports, which include the static website zone and any DNS zone suffix
+	endpoints := account.Properties.PrimaryEndpoints
+	for _, pair := range []struct {
+		reported string
+		field    *string
+	}{
+		{endpoints.Blob, &target.Endpoints.Blob},
+		{endpoints.DFS, &target.Endpoints.DFS},
+		{endpoints.Queue, &target.Endpoints.Queue},
+		{endpoints.Table, &target.Endpoints.Table},
+		{endpoints.File, &target.Endpoints.File},
+		{endpoints.Web, &target.Endpoints.Web},
+	} {
+		if pair.reported != "" {
+			*pair.field = pair.reported
+		}
+	}
+	return target, nil
+}
+
+func deriveEndpoints(accountName string, cloud CloudEnvironment) StorageEndpoints {
+	endpoint := func(service string) string {
+		return fmt.Sprintf("https://%s.%s.%s/", accountName, service, cloud.StorageEndpointSuffix)
+	}
+	return StorageEndpoints{
+		Blob:  endpoint("blob"),
+		DFS:   endpoint("dfs"),
+		Queue: endpoint("queue"),
+		Table: endpoint("table"),
+		File:  endpoint("file"),
+	}
+}
@@ -0,0 +1,132 @@
+package armory
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadTargetSelection(t *testing.T) {
+	keyVault := "/subscriptions/sub-a/resourceGroups/rg-1/providers/Microsoft.KeyVault/vaults/keys"
+	storage := "/subscriptions/sub-b/resourceGroups/rg-2/providers/Microsoft.Storage/storageAccounts/beta"
+	t.Cleanup(viper.Reset)
+
+	for name, test := range map[string]struct {
+		config   map[string]interface{}
+		err      string // Expected error, empty when the selection must load
+		accounts string
+	}{
+		"missing subscription": {
+			config: map[string]interface{}{"resource_group": "rg-1", "storage_account": "alpha"},
+			err:    "missing required config: raids.ABS.subscription_id",
+		},
+		"emulator needs no subscription": {
+			config: map[string]interface{}{"emulator.enabled": true},
+		},
+		"named accounts": {
+			config:   map[string]interface{}{"subscription_id": "sub-a", "resource_group": "rg-1", "storage_account": "alpha", "storage_accounts": []string{"gamma", storage}},
+			accounts: "alpha,gamma," + storage,
+		},
+		"uppercase account name": {
+			config: map[string]interface{}{"subscription_id": "sub-a", "resource_group": "rg-1", "storage_account": "Alpha"},
+			err:    `storage account name "Alpha" must be 3-24 lowercase letters and numbers`,
+		},
+		"short account name": {
+			config: map[string]interface{}{"subscription_id": "sub-a", "resource_group": "rg-1", "storage_accounts": []string{"ab"}},
+			err:    `storage account name "ab"`,
+		},
+		"account name without resource group": {
+			config: map[string]interface{}{"subscription_id": "sub-a", "storage_account": "alpha"},
+			err:    "missing required config: raids.ABS.resource_group",
+		},
+		"resource ID without resource group": {
+			config:   map[string]interface{}{"subscription_id": "sub-a", "storage_accounts": []string{storage}},
+			accounts: storage,
+		},
+		"resource ID of another type": {
+			config: map[string]interface{}{"subscription_id": "sub-a", "storage_accounts": []string{keyVault}},
+			err:    "is not a storage account resource ID",
+		},
+		"truncated resource ID": {
+			config: map[string]interface{}{"subscription_id": "sub-a", "storage_accounts": []string{"/subscriptions/sub-a/resourceGroups/rg-1"}},
+			err:    "is not a storage account resource ID",
+		},
+		"unknown cloud": {
+			config: map[string]interface{}{"subscription_id": "sub-a", "cloud": "AzureMoonCloud"},
+			err:    `unknown cloud environment "AzureMoonCloud"`,
+		},
+		"whole subscription": {
+			config: map[string]interface{}{"subscription_id": "sub-a"},
+		},
+	} {
+		viper.Reset()
+		for key, value := range test.config {
+			viper.Set("raids.ABS."+key, value)
+		}
+		selection, err := LoadTargetSelection()
+		switch {
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: got %v, want an error containing %q", name, err, test.err)
+		case test.err == "" && err != nil:
+			t.Errorf("%s: %v", name, err)
+		case test.err == "" && strings.Join(selection.Accounts, ",") != test.accounts:
+			t.Errorf("%s: accounts %v, want %s", name, selection.Accounts, test.accounts)
+		}
+	}
+}
+
+func TestEmulatorSelection(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Reset()
+	viper.Set("raids.ABS.emulator.enabled", true)
+	viper.Set("raids.ABS.container", "raid")
+
+	selection, err := LoadTargetSelection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := selection.Resolve(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := targets[0]
+	if len(targets) != 1 || target.AccountName != EmulatorAccountName || target.Endpoints.Blob != defaultEmulatorBlobEndpoint ||
+		target.Container != "raid" || target.SharedKey == nil || target.SharedKey.AccountKey != EmulatorAccountKey {
+		t.Errorf("resolved %+v", targets)
+	}
+}
+
+func TestTagSelection(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Reset()
+	viper.Set("raids.ABS.subscription_id", "sub-a")
+	viper.Set("raids.ABS.tags", map[string]string{"Team": "data", "owner": "*"})
+	selection, err := LoadTargetSelection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		tags map[string]string
+		want bool
+	}{
+		{map[string]string{"team": "data", "Owner": "alice"}, true},
+		{map[string]string{"TEAM": "data", "owner": ""}, true},
+		{map[string]string{"team": "Data", "owner": "alice"}, false}, // values are matched exactly
+		{map[string]string{"team": "data"}, false},
+		{map[string]string{"owner": "alice"}, false},
+		{nil, false},
+	} {
+		account := StorageAccount{Name: "alpha", Tags: test.tags}
+		if got := selection.selects(account); got != test.want {
+			t.Errorf("selects(tags %v) = %t, want %t", test.tags, got, test.want)
+		}
+	}
+
+	selection.Accounts = []string{"alpha"}
+	if selection.selects(StorageAccount{Name: "beta", Tags: map[string]string{"team": "data", "owner": "bob"}}) {
+		t.Error("an unlisted account was selected by its tags alone")
+	}
+}
@@ -0,0 +1,179 @@
+package armory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Registration assignments read to find Azure Lighthouse delegations to other tenants
+const managedServicesAPIVersion = "2022-10-01"
+
+// LoadTrustedTenants reads raids.ABS.tenancy.trusted_tenants, the tenant IDs allowed to reach the account besides its own
+func LoadTrustedTenants() []string {
+	return viper.GetStringSlice("raids.ABS.tenancy.trusted_tenants")
+}
+
+// GetSubscriptionTenant returns the ID of the tenant that owns the subscription
+func (c *ARMClient) GetSubscriptionTenant(ctx context.Context, subscriptionID string) (string, error) {
+	var subscription struct {
+		TenantID string `json:"tenantId"`
+	}
+	if err := c.Get(ctx, "/subscriptions/"+subscriptionID, subscriptionsAPIVersion, &subscription); err != nil {
+		return "", err
+	}
+	return subscription.TenantID, nil
+}
+
+// DelegatedTenant is an Azure Lighthouse delegation of a subscription or resource group to another tenant
+type DelegatedTenant struct {
+	ID         string
+	Offer      string
+	TenantID   string
+	TenantName string // Display name of the managing tenant, when published in the offer
+}
+
+// ListDelegatedTenants returns the Azure Lighthouse delegations that apply to resourceGroup within the subscription
+func (c *ARMClient) ListDelegatedTenants(ctx context.Context, subscriptionID, resourceGroup string) ([]DelegatedTenant, error) {
+	var delegations []DelegatedTenant
+	for _, scope := range []string{"/subscriptions/" + subscriptionID, "/subscriptions/" + subscriptionID + "/resourceGroups/" + resourceGroup} {
+		path := scope + "/providers/Microsoft.ManagedServices/registrationAssignments?$expandRegistrationDefinition=true"
+		err := c.List(ctx, path, managedServicesAPIVersion, func(item json.RawMessage) error {
+			var assignment struct {
+				ID         string `json:"id"`
+				Properties struct {
+					RegistrationDefinition struct {
+						Properties struct {
+							RegistrationDefinitionName string `json:"registrationDefinitionName"`
+							ManagedByTenantID          string `json:"managedByTenantId"`
+							ManagedByTenantName        string `json:"managedByTenantName"`
+						} `json:"properties"`
+					} `json:"registrationDefinition"`
+				} `json:"properties"`
+			}
+			if err := json.Unmarshal(item, &assignment); err != nil {
+				return err
+			}
+			// the subscription listing also returns the resource group assignments, so skip duplicates
+			for _, existing := range delegations {
+				if strings.EqualFold(existing.ID, assignment.ID) {
+					return nil
+				}
+			}
+			definition := assignment.Properties.RegistrationDefinition.Properties
+			delegations = append(delegations, DelegatedTenant{
+				ID:         assignment.ID,
+				Offer:      definition.RegistrationDefinitionName,
+				TenantID:   definition.ManagedByTenantID,
+				TenantName: definition.ManagedByTenantName,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return delegations, nil
+}
+
+// microsoftTenants own the first-party applications, such as Azure Backup, that Azure itself registers in every directory
+var microsoftTenants = []string{
+	"f8cdef31-a31e-4b4a-93e4-5f571e91255a", // Microsoft Services
+	"72f988bf-86f1-41af-91ab-2d7cd011db47", // Microsoft
+}
+
+// TenantReview collects every reference to a tenant other than the account's own and the trusted tenants
+type TenantReview struct {
+	HomeTenant string
+	Trusted    []string
+	Foreign    []string
+	Orphaned   []string // Role assignments whose principal has been deleted from the home directory
+}
+
+// trusts reports whether tenantID is the home tenant or one of the trusted tenants
+func (r *TenantReview) trusts(tenantID string) bool {
+	return strings.EqualFold(tenantID, r.HomeTenant) || containsFold(r.Trusted, tenantID)
+}
+
+// Check records reference when tenantID is not trusted
+func (r *TenantReview) Check(tenantID, reference string) {
+	if !r.trusts(tenantID) {
+		r.Foreign = append(r.Foreign, fmt.Sprintf("%s (tenant %s)", reference, tenantID))
+	}
+}
+
+// ReviewPrincipals resolves the principals of role assignments through Graph and records those from other tenants.
+// Guests are traced to the tenant of their home domain; principals that no longer resolve are recorded as orphaned.
+func (r *TenantReview) ReviewPrincipals(ctx context.Context, graph *GraphClient, assignments []RoleAssignment) error {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, assignment := range assignments {
+		principal := assignment.Properties.PrincipalID
+		if assignment.Properties.PrincipalType == "ForeignGroup" {
+			r.Foreign = append(r.Foreign, fmt.Sprintf("foreign group %s assigned at %s", principal, assignment.Properties.Scope))
+			continue
+		}
+		if !seen[principal] {
+			seen[principal] = true
+			ids = append(ids, principal)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	objects, err := graph.GetDirectoryObjects(ctx, ids)
+	if err != nil {
+		return err
+	}
+	resolved := make(map[string]bool)
+	for _, object := range objects {
+		resolved[strings.ToLower(object.ID)] = true
+		switch {
+		case strings.HasSuffix(object.Type, ".user") && (strings.EqualFold(object.UserType, "Guest") || strings.Contains(strings.ToUpper(object.UserPrincipalName), "#EXT#")):
+			if err := r.reviewGuest(ctx, graph, object.ID); err != nil {
+				return err
+			}
+		// managed identities are owned by Microsoft's tenant but live in the home directory
+		case strings.HasSuffix(object.Type, ".servicePrincipal") && object.AppOwnerOrganizationID != "" &&
+			object.ServicePrincipalType != "ManagedIdentity" && !containsFold(microsoftTenants, object.AppOwnerOrganizationID):
+			r.Check(object.AppOwnerOrganizationID, fmt.Sprintf("service principal %s (%s) holds a role assignment", object.DisplayName, object.ID))
+		}
+	}
+	// assignments cannot name principals from other directories, so an ID Graph does not know has been deleted
+	for _, assignment := range assignments {
+		principal := assignment.Properties.PrincipalID
+		if assignment.Properties.PrincipalType != "ForeignGroup" && !resolved[strings.ToLower(principal)] {
+			r.Orphaned = append(r.Orphaned, fmt.Sprintf("%s assigned to deleted principal %s", resourceName(assignment.ID), principal))
+		}
+	}
+	return nil
+}
+
+// reviewGuest records the guest with id unless its home tenant can be resolved and is trusted
+func (r *TenantReview) reviewGuest(ctx context.Context, graph *GraphClient, id string) error {
+	guest, err := graph.GetGuestUser(ctx, id)
+	if err != nil {
+		return fmt.Errorf("unable to read guest user %s: %v", id, err)
+	}
+	reference := fmt.Sprintf("guest user %s (%s) holds a role assignment", guest.DisplayName, guest.ID)
+	if guest.PersonalAccount() {
+		r.Foreign = append(r.Foreign, reference+" and signs in with a personal Microsoft account")
+		return nil
+	}
+	domain := guest.HomeDomain()
+	if domain == "" {
+		r.Foreign = append(r.Foreign, reference+" from an unknown home directory")
+		return nil
+	}
+	tenantID, err := graph.FindTenantByDomain(ctx, domain)
+	if err != nil || tenantID == "" {
+		r.Foreign = append(r.Foreign, fmt.Sprintf("%s from %s, whose tenant could not be resolved", reference, domain))
+		return nil
+	}
+	r.Check(tenantID, fmt.Sprintf("%s from %s", reference, domain))
+	return nil
+}
@@ -0,0 +1,113 @@
+package armory
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func roleAssignmentFixture(name, principalID, principalType string) RoleAssignment {
+	var assignment RoleAssignment
+	assignment.ID = "/subscriptions/sub-a/providers/Microsoft.Authorization/roleAssignments/" + name
+	assignment.Properties.PrincipalID = principalID
+	assignment.Properties.PrincipalType = principalType
+	assignment.Properties.Scope = "/subscriptions/sub-a"
+	return assignment
+}
+
+func TestReviewPrincipals(t *testing.T) {
+	_, graph := newFakeGraph(t, map[string]string{
+		"POST /v1.0/directoryObjects/getByIds": `{"value":[
+			{"@odata.type":"#microsoft.graph.user","id":"member","displayName":"Member","userPrincipalName":"member@home.onmicrosoft.com"},
+			{"@odata.type":"#microsoft.graph.user","id":"partner-guest","displayName":"Partner","userPrincipalName":"pat_partner.com#EXT#@home.onmicrosoft.com"},
+			{"@odata.type":"#microsoft.graph.user","id":"vendor-guest","displayName":"Vendor","userPrincipalName":"val_vendor.com#EXT#@home.onmicrosoft.com"},
+			{"@odata.type":"#microsoft.graph.user","id":"personal-guest","displayName":"Personal","userPrincipalName":"pip_outlook.com#EXT#@home.onmicrosoft.com"},
+			{"@odata.type":"#microsoft.graph.servicePrincipal","id":"backup","displayName":"Backup Management Service","appOwnerOrganizationId":"f8cdef31-a31e-4b4a-93e4-5f571e91255a","servicePrincipalType":"Application"},
+			{"@odata.type":"#microsoft.graph.servicePrincipal","id":"saas","displayName":"SaaS connector","appOwnerOrganizationId":"tenant-saas","servicePrincipalType":"Application"}
+		]}`,
+		"GET /v1.0/users/partner-guest": `{"id":"partner-guest","displayName":"Partner","userType":"Guest","mail":"pat@partner.com",
+			"userPrincipalName":"pat_partner.com#EXT#@home.onmicrosoft.com","identities":[{"signInType":"userPrincipalName","issuer":"home.onmicrosoft.com"},{"signInType":"federated","issuer":"ExternalAzureAD"}]}`,
+		"GET /v1.0/users/vendor-guest": `{"id":"vendor-guest","displayName":"Vendor","userType":"Guest",
+			"userPrincipalName":"val_vendor.com#EXT#@home.onmicrosoft.com","identities":[{"signInType":"federated","issuer":"ExternalAzureAD"}]}`,
+		"GET /v1.0/users/personal-guest": `{"id":"personal-guest","displayName":"Personal","userType":"Guest",
+			"userPrincipalName":"pip_outlook.com#EXT#@home.onmicrosoft.com","identities":[{"signInType":"federated","issuer":"MicrosoftAccount"}]}`,
+		"GET /v1.0/tenantRelationships/findTenantInformationByDomainName(domainName='partner.com')": `{"tenantId":"tenant-partner"}`,
+		"GET /v1.0/tenantRelationships/findTenantInformationByDomainName(domainName='vendor.com')":  `{"tenantId":"tenant-vendor"}`,
+	})
+
+	review := &TenantReview{HomeTenant: "tenant-home", Trusted: []string{"tenant-partner"}}
+	err := review.ReviewPrincipals(context.Background(), graph, []RoleAssignment{
+		roleAssignmentFixture("a1", "member", "User"),
+		roleAssignmentFixture("a2", "partner-guest", "User"),
+		roleAssignmentFixture("a3", "vendor-guest", "User"),
+		roleAssignmentFixture("a4", "personal-guest", "User"),
+		roleAssignmentFixture("a5", "backup", "ServicePrincipal"),
+		roleAssignmentFixture("a6", "saas", "ServicePrincipal"),
+		roleAssignmentFixture("a7", "deleted", "User"),
+		roleAssignmentFixture("a8", "lighthouse-group", "ForeignGroup"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	foreign := strings.Join(review.Foreign, "\n")
+	for _, want := range []string{
+		"foreign group lighthouse-group",
+		"guest user Vendor (vendor-guest) holds a role assignment from vendor.com (tenant tenant-vendor)",
+		"guest user Personal (personal-guest) holds a role assignment and signs in with a personal Microsoft account",
+		"service principal SaaS connector (saas) holds a role assignment (tenant tenant-saas)",
+	} {
+		if !strings.Contains(foreign, want) {
+			t.Errorf("%q missing from foreign references:\n%s", want, foreign)
+		}
+	}
+	if len(review.Foreign) != 4 {
+		t.Errorf("recorded %d foreign references, want 4:\n%s", len(review.Foreign), foreign)
+	}
+	if strings.Join(review.Orphaned, ",") != "a7 assigned to deleted principal deleted" {
+		t.Errorf("orphaned %v", review.Orphaned)
+	}
+}
+
+func TestGuestHomeDomain(t *testing.T) {
+	for want, guest := range map[string]GuestUser{
+		"partner.com": {Mail: "pat@Partner.com", UserPrincipalName: "pat_partner.com#EXT#@home.onmicrosoft.com"},
+		"vendor.com":  {UserPrincipalName: "val_vendor.com#EXT#@home.onmicrosoft.com"},
+		"gmail.com": {Mail: "gus@example.org", UserPrincipalName: "gus#EXT#@home.onmicrosoft.com",
+			Identities: []GuestIdentity{{"userPrincipalName", "home.onmicrosoft.com"}, {"federated", "gmail.com"}}},
+		"": {UserPrincipalName: "member@home.onmicrosoft.com"},
+	} {
+		if got := guest.HomeDomain(); got != want {
+			t.Errorf("%+v: got %q, want %q", guest, got, want)
+		}
+	}
+}
+
+func TestCrossTenantReplicationSetting(t *testing.T) {
+	target := recordedTarget()
+	for name, test := range map[string]struct {
+		setting string
+		passed  bool
+	}{
+		"omitted":  {"", true},
+		"disabled": {`"allowCrossTenantReplication":false,`, true},
+		"enabled":  {`"allowCrossTenantReplication":true,`, false},
+	} {
+		_, arm := newFakeARM(t, map[string]string{
+			"GET " + target.ResourceID(): `{"id":"` + target.ResourceID() + `","name":"` + target.AccountName + `",` +
+				`"properties":{` + test.setting + `"allowSharedKeyAccess":false}}`,
+			"GET /subscriptions/" + target.SubscriptionID:                                                                                         `{"tenantId":"tenant-home"}`,
+			"GET " + target.ResourceID() + "/providers/Microsoft.Authorization/roleAssignments":                                                   `{"value":[]}`,
+			"GET /subscriptions/" + target.SubscriptionID + "/providers/Microsoft.ManagedServices/registrationAssignments":                        `{"value":[]}`,
+			"GET /subscriptions/" + target.SubscriptionID + "/resourceGroups/rg-data/providers/Microsoft.ManagedServices/registrationAssignments": `{"value":[]}`,
+		})
+
+		result := (&ABS{ARM: arm}).CCC_C05_TR04_T01(target)
+		if result.Passed != test.passed {
+			t.Errorf("%s: passed=%t %s", name, result.Passed, result.Message)
+		}
+		if !test.passed && !strings.Contains(result.Message, "allowCrossTenantReplication is not disabled") {
+			t.Errorf("%s: %s", name, result.Message)
+		}
+	}
+}
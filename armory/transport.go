@@ -0,0 +1,482 @@
+package armory
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DialFunc opens a TCP connection to a host:port address
+type DialFunc func(ctx context.Context, address string) (net.Conn, error)
+
+const probeTimeout = 10 * time.Second
+
+// versionSSL30 is not defined by crypto/tls, which no longer implements SSL 3.0
+const versionSSL30 = 0x0300
+
+// TLSVersionName returns the human-readable name of a TLS protocol version
+func TLSVersionName(version uint16) string {
+	switch version {
+	case versionSSL30:
+		return "SSL 3.0"
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("unknown (0x%04x)", version)
+	}
+}
+
+// endpointAddress returns the host and host:port to dial for an https endpoint URL
+func endpointAddress(endpoint string) (host, address string, err error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", err
+	}
+	if parsed.Hostname() == "" {
+		return "", "", fmt.Errorf("endpoint %q has no host", endpoint)
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+	}
+	return parsed.Hostname(), net.JoinHostPort(parsed.Hostname(), port), nil
+}
+
+// ProtocolProbe is the outcome of a single handshake attempt at a fixed protocol version
+type ProtocolProbe struct {
+	Endpoint     string
+	Requested    uint16
+	Accepted     bool
+	Inconclusive bool   // The server was never reached or never answered, so nothing is known about the version
+	Negotiated   uint16 // Version the server answered with, if it answered with a ServerHello
+	Detail       string
+}
+
+// Refused reports whether the server answered the handshake and turned the version down
+func (p ProtocolProbe) Refused() bool {
+	return !p.Accepted && !p.Inconclusive
+}
+
+func (p ProtocolProbe) String() string {
+	switch {
+	case p.Accepted:
+		return fmt.Sprintf("%s %s accepted (negotiated %s)", p.Endpoint, TLSVersionName(p.Requested), TLSVersionName(p.Negotiated))
+	case p.Inconclusive:
+		return fmt.Sprintf("%s %s inconclusive (%s)", p.Endpoint, TLSVersionName(p.Requested), p.Detail)
+	}
+	return fmt.Sprintf("%s %s refused (%s)", p.Endpoint, TLSVersionName(p.Requested), p.Detail)
+}
+
+// handshakeRefusal is returned by rawHandshake when the server answered the ClientHello without accepting it,
+// as opposed to a network failure that says nothing about what the server supports
+type handshakeRefusal struct {
+	reason string
+}
+
+func (e *handshakeRefusal) Error() string {
+	return e.reason
+}
+
+// unreachable reports whether err is a dial, DNS or timeout failure rather than an answer from the server
+func unreachable(err error) bool {
+	var networkErr net.Error
+	if errors.As(err, &networkErr) && networkErr.Timeout() {
+		return true
+	}
+	var dialErr *net.OpError
+	if errors.As(err, &dialErr) && dialErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// ProbeProtocol attempts a handshake that offers only the requested protocol version
+func ProbeProtocol(dial DialFunc, endpoint string, version uint16) ProtocolProbe {
+	if version == versionSSL30 {
+		return probeSSL30(dial, endpoint)
+	}
+
+	probe := ProtocolProbe{Endpoint: endpoint, Requested: version}
+	host, address, err := endpointAddress(endpoint)
+	if err != nil {
+		probe.Inconclusive = true
+		probe.Detail = err.Error()
+		return probe
+	}
+
+	// every suite crypto/tls knows is offered so that a refusal can only be caused by the protocol version
+	var suites []uint16
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites = append(suites, suite.ID)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	rawConnection, err := dial(ctx, address)
+	if err != nil {
+		probe.Inconclusive = true
+		probe.Detail = fmt.Sprintf("unable to connect: %v", err)
+		return probe
+	}
+	connection := tls.Client(rawConnection, &tls.Config{
+		ServerName:         host,
+		MinVersion:         version,
+		MaxVersion:         version,
+		CipherSuites:       suites,
+		InsecureSkipVerify: true, // Only protocol support is under test here, certificates are checked separately
+	})
+	defer connection.Close()
+	// once connected, an alert, a ServerHello for another version or the server hanging up all reject the hello
+	if err := connection.HandshakeContext(ctx); err != nil {
+		probe.Inconclusive = unreachable(err)
+		probe.Detail = err.Error()
+		return probe
+	}
+
+	probe.Negotiated = connection.ConnectionState().Version
+	probe.Accepted = probe.Negotiated == version
+	if !probe.Accepted {
+		probe.Detail = fmt.Sprintf("server negotiated %s instead", TLSVersionName(probe.Negotiated))
+	}
+	return probe
+}
+
+// probeSSL30 sends a hand-built SSL 3.0 ClientHello and reports whether the server answers with an SSL 3.0 ServerHello
+func probeSSL30(dial DialFunc, endpoint string) ProtocolProbe {
+	probe := ProtocolProbe{Endpoint: endpoint, Requested: versionSSL30}
+	hello, err := rawHandshake(dial, endpoint, versionSSL30, []uint16{0x0035, 0x002f, 0x000a, 0x0039, 0x0033, 0x0016, 0x0005, 0x0004})
+	if err != nil {
+		var refusal *handshakeRefusal
+		probe.Inconclusive = !errors.As(err, &refusal)
+		probe.Detail = err.Error()
+		return probe
+	}
+	probe.Negotiated = hello.Version
+	probe.Accepted = hello.Version == versionSSL30
+	if !probe.Accepted {
+		probe.Detail = fmt.Sprintf("server answered with %s", TLSVersionName(hello.Version))
+	}
+	return probe
+}
+
+// serverHello holds the fields of a ServerHello that reveal what the server negotiated
+type serverHello struct {
+	Version     uint16
+	CipherSuite uint16
+}
+
+// rawHandshake sends a hand-built ClientHello offering only suites at version and parses the server's answer.
+// Building the hello directly lets the raid offer suites and versions that crypto/tls refuses to negotiate.
+func rawHandshake(dial DialFunc, endpoint string, version uint16, suites []uint16) (*serverHello, error) {
+	host, address, err := endpointAddress(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	hello, err := rawClientHello(host, version, suites)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	connection, err := dial(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	defer connection.Close()
+	_ = connection.SetDeadline(time.Now().Add(probeTimeout))
+	if _, err := connection.Write(hello); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(connection, header); err != nil {
+		if unreachable(err) {
+			return nil, err
+		}
+		// the server hung up or reset the connection instead of answering the hello
+		return nil, &handshakeRefusal{fmt.Sprintf("connection closed by server: %v", err)}
+	}
+	record := make([]byte, binary.BigEndian.Uint16(header[3:5]))
+	if _, err := io.ReadFull(connection, record); err != nil {
+		return nil, fmt.Errorf("truncated response: %v", err)
+	}
+
+	switch header[0] {
+	case 21:
+		if len(record) == 2 {
+			return nil, &handshakeRefusal{fmt.Sprintf("handshake alert %d", record[1])}
+		}
+		return nil, errors.New("malformed alert")
+	case 22:
+		return parseServerHello(record)
+	default:
+		return nil, fmt.Errorf("unexpected record type %d", header[0])
+	}
+}
+
+// parseServerHello reads the negotiated version and cipher suite, honouring the TLS 1.3 supported_versions extension
+func parseServerHello(record []byte) (*serverHello, error) {
+	malformed := errors.New("malformed ServerHello")
+	if len(record) < 4 || record[0] != 2 {
+		return nil, errors.New("server did not answer with a ServerHello")
+	}
+	body := record[4:]
+	// legacy version (2), random (32), then the session ID
+	if len(body) < 35 {
+		return nil, malformed
+	}
+	hello := &serverHello{Version: binary.BigEndian.Uint16(body[0:2])}
+	offset := 35 + int(body[34])
+	if len(body) < offset+3 {
+		return nil, malformed
+	}
+	hello.CipherSuite = binary.BigEndian.Uint16(body[offset : offset+2])
+	offset += 3 // cipher suite and compression method
+
+	if len(body) < offset+2 {
+		return hello, nil
+	}
+	extensions := body[offset+2:]
+	for len(extensions) >= 4 {
+		extensionType := binary.BigEndian.Uint16(extensions[0:2])
+		length := int(binary.BigEndian.Uint16(extensions[2:4]))
+		if len(extensions) < 4+length {
+			return nil, malformed
+		}
+		if extensionType == 0x002b && length == 2 {
+			hello.Version = binary.BigEndian.Uint16(extensions[4:6])
+		}
+		extensions = extensions[4+length:]
+	}
+	return hello, nil
+}
+
+// rawClientHello builds a ClientHello record offering suites at version, with the extensions servers expect.
+// For TLS 1.3 the hello carries supported_versions and an X25519 key share.
+func rawClientHello(host string, version uint16, suites []uint16) ([]byte, error) {
+	random := make([]byte, 32)
+	sessionID := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(sessionID); err != nil {
+		return nil, err
+	}
+
+	legacyVersion := version
+	if version == tls.VersionTLS13 {
+		legacyVersion = tls.VersionTLS12
+	}
+	body := uint16Bytes(legacyVersion)
+	body = append(body, random...)
+	if version == tls.VersionTLS13 {
+		// a legacy session ID keeps middlebox-compatible servers happy
+		body = append(body, byte(len(sessionID)))
+		body = append(body, sessionID...)
+	} else {
+		body = append(body, 0)
+	}
+	var suiteBytes []byte
+	for _, suite := range suites {
+		suiteBytes = append(suiteBytes, uint16Bytes(suite)...)
+	}
+	body = append(body, lengthPrefixed(2, suiteBytes)...)
+	body = append(body, 1, 0) // null compression only
+
+	name := []byte(host)
+	serverName := lengthPrefixed(2, append([]byte{0}, lengthPrefixed(2, name)...))
+	extensions := extension(0x0000, serverName)
+	extensions = append(extensions, extension(0x000a, lengthPrefixed(2, []byte{0x00, 0x1d, 0x00, 0x17, 0x00, 0x18}))...)
+	extensions = append(extensions, extension(0x000b, []byte{1, 0})...)
+	extensions = append(extensions, extension(0x000d, lengthPrefixed(2, []byte{
+		0x04, 0x03, 0x05, 0x03, 0x06, 0x03, 0x08, 0x04, 0x08, 0x05, 0x08, 0x06,
+		0x04, 0x01, 0x05, 0x01, 0x06, 0x01, 0x02, 0x01, 0x02, 0x03,
+	}))...)
+	if version == tls.VersionTLS13 {
+		key, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		share := append([]byte{0x00, 0x1d}, lengthPrefixed(2, key.PublicKey().Bytes())...)
+		extensions = append(extensions, extension(0x002b, lengthPrefixed(1, uint16Bytes(tls.VersionTLS13)))...)
+		extensions = append(extensions, extension(0x0033, lengthPrefixed(2, share))...)
+	}
+	body = append(body, lengthPrefixed(2, extensions)...)
+
+	handshake := append([]byte{1}, lengthPrefixed(3, body)...)
+	recordVersion := legacyVersion
+	if version == tls.VersionTLS13 {
+		recordVersion = tls.VersionTLS10
+	}
+	record := append([]byte{22}, uint16Bytes(recordVersion)...)
+	return append(record, lengthPrefixed(2, handshake)...), nil
+}
+
+func uint16Bytes(value uint16) []byte {
+	return []byte{byte(value >> 8), byte(value)}
+}
+
+// lengthPrefixed prepends the big-endian length of data using size bytes
+func lengthPrefixed(size int, data []byte) []byte {
+	prefix := make([]byte, size)
+	length := len(data)
+	for i := size - 1; i >= 0; i-- {
+		prefix[i] = byte(length)
+		length >>= 8
+	}
+	return append(prefix, data...)
+}
+
+func extension(extensionType uint16, data []byte) []byte {
+	return append(uint16Bytes(extensionType), lengthPrefixed(2, data)...)
+}
+
+// -----
+// Cipher suite enumeration
+// -----
+
+// CipherSuite is a suite offered during enumeration
+type CipherSuite struct {
+	ID   uint16
+	Name string
+}
+
+// tls12CipherSuites are offered one at a time at TLS 1.2, including legacy suites crypto/tls does not implement
+var tls12CipherSuites = func() []CipherSuite {
+	suites := []CipherSuite{
+		{0x0000, "TLS_NULL_WITH_NULL_NULL"},
+		{0x0001, "TLS_RSA_WITH_NULL_MD5"},
+		{0x0002, "TLS_RSA_WITH_NULL_SHA"},
+		{0x003b, "TLS_RSA_WITH_NULL_SHA256"},
+		{0xc006, "TLS_ECDHE_ECDSA_WITH_NULL_SHA"},
+		{0xc010, "TLS_ECDHE_RSA_WITH_NULL_SHA"},
+		{0x0003, "TLS_RSA_EXPORT_WITH_RC4_40_MD5"},
+		{0x0006, "TLS_RSA_EXPORT_WITH_RC2_CBC_40_MD5"},
+		{0x0008, "TLS_RSA_EXPORT_WITH_DES40_CBC_SHA"},
+		{0x0014, "TLS_DHE_RSA_EXPORT_WITH_DES40_CBC_SHA"},
+		{0x0018, "TLS_DH_anon_WITH_RC4_128_MD5"},
+		{0x0034, "TLS_DH_anon_WITH_AES_128_CBC_SHA"},
+		{0x0004, "TLS_RSA_WITH_RC4_128_MD5"},
+		{0x0007, "TLS_RSA_WITH_IDEA_CBC_SHA"},
+		{0x0009, "TLS_RSA_WITH_DES_CBC_SHA"},
+		{0x003d, "TLS_RSA_WITH_AES_256_CBC_SHA256"},
+		{0x0041, "TLS_RSA_WITH_CAMELLIA_128_CBC_SHA"},
+		{0x0084, "TLS_RSA_WITH_CAMELLIA_256_CBC_SHA"},
+		{0x0016, "TLS_DHE_RSA_WITH_3DES_EDE_CBC_SHA"},
+		{0x0033, "TLS_DHE_RSA_WITH_AES_128_CBC_SHA"},
+		{0x0039, "TLS_DHE_RSA_WITH_AES_256_CBC_SHA"},
+		{0x0067, "TLS_DHE_RSA_WITH_AES_128_CBC_SHA256"},
+		{0x006b, "TLS_DHE_RSA_WITH_AES_256_CBC_SHA256"},
+		{0x009e, "TLS_DHE_RSA_WITH_AES_128_GCM_SHA256"},
+		{0x009f, "TLS_DHE_RSA_WITH_AES_256_GCM_SHA384"},
+		{0xccaa, "TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256"},
+		{0xc024, "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA384"},
+		{0xc028, "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA384"},
+	}
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		for _, version := range suite.SupportedVersions {
+			if version == tls.VersionTLS12 {
+				suites = append(suites, CipherSuite{suite.ID, suite.Name})
+				break
+			}
+		}
+	}
+	return suites
+}()
+
+// tls13CipherSuites are every suite defined for TLS 1.3
+var tls13CipherSuites = []CipherSuite{
+	{0x1301, "TLS_AES_128_GCM_SHA256"},
+	{0x1302, "TLS_AES_256_GCM_SHA384"},
+	{0x1303, "TLS_CHACHA20_POLY1305_SHA256"},
+	{0x1304, "TLS_AES_128_CCM_SHA256"},
+	{0x1305, "TLS_AES_128_CCM_8_SHA256"},
+}
+
+// CipherSuiteWeaknesses lists the reasons a suite is considered weak, judged from its IANA name
+func CipherSuiteWeaknesses(name string) []string {
+	var weaknesses []string
+	checks := []struct {
+		weak   bool
+		reason string
+	}{
+		{strings.Contains(name, "NULL"), "no encryption"},
+		{strings.Contains(name, "EXPORT"), "export grade"},
+		{strings.Contains(name, "_anon_"), "anonymous key exchange"},
+		{strings.HasPrefix(name, "TLS_RSA_"), "RSA key exchange"},
+		{strings.Contains(name, "_CBC_"), "CBC mode"},
+		{strings.HasSuffix(name, "_SHA"), "SHA-1 MAC"},
+		{strings.HasSuffix(name, "_MD5"), "MD5 MAC"},
+		{strings.Contains(name, "_RC4_") || strings.Contains(name, "_RC2_"), "RC4/RC2 cipher"},
+		{strings.Contains(name, "DES"), "DES/3DES cipher"},
+	}
+	for _, check := range checks {
+		if check.weak {
+			weaknesses = append(weaknesses, check.reason)
+		}
+	}
+	return weaknesses
+}
+
+// AcceptedCipherSuite is a suite the server agreed to when offered on its own
+type AcceptedCipherSuite struct {
+	CipherSuite
+	Version    uint16
+	Weaknesses []string
+}
+
+// EnumerateCipherSuites offers each known TLS 1.2 and TLS 1.3 suite on its own and returns those the server accepts
+func EnumerateCipherSuites(dial DialFunc, endpoint string) ([]AcceptedCipherSuite, error) {
+	if _, _, err := endpointAddress(endpoint); err != nil {
+		return nil, err
+	}
+
+	var accepted []AcceptedCipherSuite
+	var lastNetworkErr error
+	for _, offer := range []struct {
+		version uint16
+		suites  []CipherSuite
+	}{
+		{tls.VersionTLS12, tls12CipherSuites},
+		{tls.VersionTLS13, tls13CipherSuites},
+	} {
+		for _, suite := range offer.suites {
+			hello, err := rawHandshake(dial, endpoint, offer.version, []uint16{suite.ID})
+			if err != nil {
+				// servers commonly refuse a suite by resetting the connection, so only dial, lookup and timeout failures mean unreachable
+				if unreachable(err) {
+					lastNetworkErr = err
+				}
+				continue
+			}
+			if hello.Version != offer.version || hello.CipherSuite != suite.ID {
+				continue
+			}
+			accepted = append(accepted, AcceptedCipherSuite{
+				CipherSuite: suite,
+				Version:     offer.version,
+				Weaknesses:  CipherSuiteWeaknesses(suite.Name),
+			})
+		}
+	}
+	if len(accepted) == 0 && lastNetworkErr != nil {
+		return nil, lastNetworkErr
+	}
+	return accepted, nil
+}
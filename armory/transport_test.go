@@ -0,0 +1,138 @@
+package armory
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func directDial(ctx context.Context, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+// newTLSServer starts an HTTPS server limited by config, which may be nil for the crypto/tls defaults
+func newTLSServer(t *testing.T, config *tls.Config) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // refused handshakes are expected
+	if config != nil {
+		server.TLS = config
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProbeProtocol(t *testing.T) {
+	server := newTLSServer(t, &tls.Config{MinVersion: tls.VersionTLS12})
+
+	baseline := ProbeProtocol(directDial, server.URL, tls.VersionTLS12)
+	if !baseline.Accepted || baseline.Negotiated != tls.VersionTLS12 {
+		t.Errorf("TLS 1.2 baseline: %s", baseline)
+	}
+	for _, version := range []uint16{versionSSL30, tls.VersionTLS10, tls.VersionTLS11} {
+		probe := ProbeProtocol(directDial, server.URL, version)
+		if !probe.Refused() {
+			t.Errorf("%s should be refused by a TLS 1.2+ server: %s", TLSVersionName(version), probe)
+		}
+	}
+}
+
+func TestProbeProtocolUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := "https://" + listener.Addr().String()
+	listener.Close()
+
+	for _, version := range []uint16{versionSSL30, tls.VersionTLS10, tls.VersionTLS12} {
+		probe := ProbeProtocol(directDial, endpoint, version)
+		if !probe.Inconclusive || probe.Refused() || probe.Accepted {
+			t.Errorf("%s against a closed port should be inconclusive: %s", TLSVersionName(version), probe)
+		}
+	}
+}
+
+func TestEnumerateCipherSuitesFlagsWeakSuites(t *testing.T) {
+	server := newTLSServer(t, &tls.Config{
+		MaxVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
+	})
+
+	accepted, err := EnumerateCipherSuites(directDial, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string][]string)
+	for _, suite := range accepted {
+		if suite.Version != tls.VersionTLS12 {
+			t.Errorf("%s accepted at %s by a TLS 1.2 server", suite.Name, TLSVersionName(suite.Version))
+		}
+		found[suite.Name] = suite.Weaknesses
+	}
+	for name, want := range map[string][]string{
+		"TLS_RSA_WITH_AES_128_CBC_SHA":          {"RSA key exchange", "CBC mode", "SHA-1 MAC"},
+		"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":    {"CBC mode", "SHA-1 MAC"},
+		"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256": nil,
+	} {
+		weaknesses, ok := found[name]
+		if !ok {
+			t.Errorf("%s was not enumerated, got %v", name, found)
+			continue
+		}
+		if strings.Join(weaknesses, ",") != strings.Join(want, ",") {
+			t.Errorf("%s flagged %v, want %v", name, weaknesses, want)
+		}
+	}
+	if len(found) != 3 {
+		t.Errorf("enumerated %d suites, want exactly the 3 the server offers: %v", len(found), found)
+	}
+}
+
+func TestEnumerateCipherSuitesUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := "https://" + listener.Addr().String()
+	listener.Close()
+	if _, err := EnumerateCipherSuites(directDial, endpoint); err == nil {
+		t.Error("expected an error for an endpoint that cannot be reached")
+	}
+}
+
+func TestEnumerateCipherSuitesResetIsRefusal(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// read the hello, then refuse it with a reset: a linger of zero makes Close abort the connection
+			io.ReadFull(connection, make([]byte, 5))
+			connection.(*net.TCPConn).SetLinger(0)
+			connection.Close()
+		}
+	}()
+
+	accepted, err := EnumerateCipherSuites(directDial, "https://"+listener.Addr().String())
+	if err != nil || len(accepted) != 0 {
+		t.Errorf("a server resetting every hello should accept no suites without an error, got %v, %v", accepted, err)
+	}
+}
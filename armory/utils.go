@@ -1,23 +1,18 @@
 package armory
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/privateerproj/privateer-sdk/raidengine"
 )
 
 // MakeGETRequest makes a GET request to the specified endpoint and returns the status code
-func MakeGETRequest(endpoint string, result *raidengine.MovementResult) *http.Response {
+func MakeGETRequest(client *http.Client, endpoint string, result *raidengine.MovementResult) *http.Response {
 	result.Description = fmt.Sprintf("Making GET request to endpoint: %s", endpoint)
 
-	// Create an HTTP client with a timeout for safety
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
 	// Make the GET request
 	response, err := client.Get(endpoint)
 	if err != nil {
@@ -79,24 +74,98 @@ func CheckTLSVersion(response *http.Response, result *raidengine.MovementResult)
 	}
 }
 
-func ConfirmHTTPSRedirect(httpsUrl string, result *raidengine.MovementResult) {
-	url := strings.Replace(httpsUrl, "https", "http", 1)
-	response := MakeGETRequest(url, result)
+// HTTPOutcome classifies how an endpoint answered a plain HTTP request
+type HTTPOutcome int
+
+const (
+	HTTPServed                HTTPOutcome = iota // The request was answered over HTTP without a redirect or rejection
+	HTTPRedirectedToHTTPS                        // The first response redirected to an https:// location
+	HTTPRejectedRequiresHTTPS                    // The request was refused with the AccountRequiresHttps error code
+)
+
+// ClassifyHTTPResponse decides which HTTPOutcome the first, unfollowed response to a plain HTTP request represents
+func ClassifyHTTPResponse(response *http.Response, errorCode string) HTTPOutcome {
+	if response.StatusCode >= 300 && response.StatusCode < 400 {
+		if location, err := response.Location(); err == nil && location.Scheme == "https" {
+			return HTTPRedirectedToHTTPS
+		}
+	}
+	if errorCode == "AccountRequiresHttps" {
+		return HTTPRejectedRequiresHTTPS
+	}
+	return HTTPServed
+}
+
+// ConfirmHTTPSRedirect sends a plain HTTP request to the http:// form of httpsUrl and inspects the first response.
+// Azure Storage refuses HTTP with AccountRequiresHttps instead of redirecting, so acceptRejection lets that count as a pass.
+func ConfirmHTTPSRedirect(client *http.Client, httpsUrl string, acceptRejection bool, result *raidengine.MovementResult) {
+	url := strings.Replace(httpsUrl, "https://", "http://", 1)
 	result.Description = fmt.Sprintf("Checking for HTTPS redirection on: %s", url)
 
-	if !result.Passed {
+	response, errorCode, err := SendRequestProbe(client, url, RequestProbe{Name: "GET", Method: http.MethodGet, Path: "/"})
+	if err != nil {
+		result.Passed = false
+		result.Message = fmt.Sprintf("HTTP request failed: %v", err)
 		return
 	}
 
-	// if response.Header.Get("Location") contains https
-	result.Message = "Checking whether HTTP is redirected to HTTPS"
-	location := response.Request.URL.Scheme
-
-	if location == "https" {
+	switch ClassifyHTTPResponse(response, errorCode) {
+	case HTTPRedirectedToHTTPS:
 		result.Passed = true
-		result.Message = "HTTP was redirected to HTTPS"
-	} else {
+		result.Message = fmt.Sprintf("HTTP was redirected to HTTPS (HTTP %d to %s)", response.StatusCode, response.Header.Get("Location"))
+	case HTTPRejectedRequiresHTTPS:
+		result.Passed = acceptRejection
+		result.Message = fmt.Sprintf("HTTP was rejected with AccountRequiresHttps (HTTP %d) rather than redirected", response.StatusCode)
+	default:
 		result.Passed = false
-		result.Message = "HTTP was not redirected to HTTPS"
+		result.Message = fmt.Sprintf("HTTP was served without redirecting to HTTPS (HTTP %d)", response.StatusCode)
+	}
+}
+
+// RequestProbe is a single unauthenticated request sent to check how the service treats a given verb
+type RequestProbe struct {
+	Name    string
+	Method  string
+	Path    string // Appended to the blob endpoint, including any query string
+	Headers map[string]string
+}
+
+// transportProbes covers every verb and the Blob REST list operations without modifying any data.
+// Writes and deletes target a blob name that does not exist and carry no credentials.
+func transportProbes(container string) []RequestProbe {
+	blob := "/" + container + "/" + testBlobName("nonexistent")
+	return []RequestProbe{
+		{Name: "List Containers", Method: http.MethodGet, Path: "/?comp=list"},
+		{Name: "List Blobs", Method: http.MethodGet, Path: "/" + container + "?restype=container&comp=list"},
+		{Name: "PUT", Method: http.MethodPut, Path: blob, Headers: map[string]string{"x-ms-blob-type": "BlockBlob"}},
+		{Name: "HEAD", Method: http.MethodHead, Path: blob},
+		{Name: "DELETE", Method: http.MethodDelete, Path: blob},
+		{Name: "OPTIONS", Method: http.MethodOptions, Path: blob, Headers: map[string]string{
+			"Origin":                        "https://privateer.invalid",
+			"Access-Control-Request-Method": http.MethodPut,
+		}},
+	}
+}
+
+// SendRequestProbe sends probe to baseURL without following redirects and returns the first response.
+// The body is closed before returning; the error code is taken from the x-ms-error-code header.
+func SendRequestProbe(client *http.Client, baseURL string, probe RequestProbe) (response *http.Response, errorCode string, err error) {
+	request, err := http.NewRequestWithContext(withoutRetries(context.Background()), probe.Method, strings.TrimSuffix(baseURL, "/")+probe.Path, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	for name, value := range probe.Headers {
+		request.Header.Set(name, value)
+	}
+
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	response, err = noRedirects.Do(request)
+	if err != nil {
+		return nil, "", err
 	}
+	response.Body.Close()
+	return response, response.Header.Get("x-ms-error-code"), nil
 }
@@ -0,0 +1,186 @@
+package armory
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/privateerproj/privateer-sdk/raidengine"
+)
+
+func TestClassifyHTTPResponse(t *testing.T) {
+	for name, test := range map[string]struct {
+		status    int
+		location  string
+		errorCode string
+		want      HTTPOutcome
+	}{
+		"permanent redirect to https": {http.StatusMovedPermanently, "https://account.blob.core.windows.net/", "", HTTPRedirectedToHTTPS},
+		"temporary redirect to https": {http.StatusTemporaryRedirect, "https://account.blob.core.windows.net/", "", HTTPRedirectedToHTTPS},
+		"redirect to http":            {http.StatusFound, "http://elsewhere.example/", "", HTTPServed},
+		"redirect without location":   {http.StatusFound, "", "", HTTPServed},
+		"secure transfer required":    {http.StatusBadRequest, "", "AccountRequiresHttps", HTTPRejectedRequiresHTTPS},
+		"other rejection":             {http.StatusForbidden, "", "AuthorizationFailure", HTTPServed},
+		"served":                      {http.StatusOK, "", "", HTTPServed},
+	} {
+		response := &http.Response{StatusCode: test.status, Header: make(http.Header), Request: &http.Request{}}
+		if test.location != "" {
+			response.Header.Set("Location", test.location)
+		}
+		if got := ClassifyHTTPResponse(response, test.errorCode); got != test.want {
+			t.Errorf("%s: got %v, want %v", name, got, test.want)
+		}
+	}
+}
+
+func TestConfirmHTTPSRedirect(t *testing.T) {
+	for name, test := range map[string]struct {
+		handler         http.HandlerFunc
+		acceptRejection bool
+		passed          bool
+		message         string
+	}{
+		"redirected": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "https://account.blob.core.windows.net/", http.StatusMovedPermanently)
+			},
+			passed:  true,
+			message: "redirected to HTTPS",
+		},
+		"rejection accepted": {
+			handler:         requiresHTTPS,
+			acceptRejection: true,
+			passed:          true,
+			message:         "rejected with AccountRequiresHttps",
+		},
+		"rejection not accepted": {
+			handler: requiresHTTPS,
+			passed:  false,
+			message: "rather than redirected",
+		},
+		"served": {
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			passed:  false,
+			message: "served without redirecting",
+		},
+	} {
+		server := httptest.NewServer(test.handler)
+		result := raidengine.MovementResult{}
+		ConfirmHTTPSRedirect(server.Client(), server.URL, test.acceptRejection, &result)
+		server.Close()
+		if result.Passed != test.passed || !strings.Contains(result.Message, test.message) {
+			t.Errorf("%s: got passed=%t %q", name, result.Passed, result.Message)
+		}
+	}
+}
+
+func TestConfirmHTTPSRedirectUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(requiresHTTPS))
+	server.Close()
+	result := raidengine.MovementResult{Passed: true}
+	ConfirmHTTPSRedirect(server.Client(), server.URL, true, &result)
+	if result.Passed || !strings.Contains(result.Message, "HTTP request failed") {
+		t.Errorf("an unreachable endpoint passed: %q", result.Message)
+	}
+}
+
+func requiresHTTPS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("x-ms-error-code", "AccountRequiresHttps")
+	w.WriteHeader(http.StatusBadRequest)
+}
+
+func TestSendRequestProbe(t *testing.T) {
+	var mutex sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		received = append(received, r.Method+" "+r.URL.RequestURI()+" "+r.Header.Get("x-ms-blob-type")+r.Header.Get("Access-Control-Request-Method"))
+		mutex.Unlock()
+		if r.URL.Path == "/elsewhere" {
+			t.Errorf("followed a redirect for %s", r.Method)
+			return
+		}
+		w.Header().Set("Location", "/elsewhere")
+		w.Header().Set("x-ms-error-code", "Redirected")
+		w.WriteHeader(http.StatusFound)
+	}))
+	defer server.Close()
+
+	probes := transportProbes("raid")
+	for _, probe := range probes {
+		response, errorCode, err := SendRequestProbe(server.Client(), server.URL+"/", probe)
+		if err != nil {
+			t.Fatalf("%s: %v", probe.Name, err)
+		}
+		if response.StatusCode != http.StatusFound || errorCode != "Redirected" {
+			t.Errorf("%s: got HTTP %d %q, want the unfollowed redirect", probe.Name, response.StatusCode, errorCode)
+		}
+	}
+
+	var methods []string
+	for i, request := range received {
+		fields := strings.Fields(request)
+		methods = append(methods, fields[0])
+		if !strings.HasSuffix(fields[1], strings.TrimPrefix(probes[i].Path, "/")) {
+			t.Errorf("%s sent to %s, want %s", probes[i].Name, fields[1], probes[i].Path)
+		}
+	}
+	if strings.Join(methods, ",") != "GET,GET,PUT,HEAD,DELETE,OPTIONS" {
+		t.Errorf("sent %v", received)
+	}
+	if !strings.HasSuffix(received[2], " BlockBlob") || !strings.HasSuffix(received[5], " PUT") {
+		t.Errorf("probe headers were not sent: %v", received)
+	}
+}
+
+func TestTransportMovements(t *testing.T) {
+	status, errorCode := http.StatusBadRequest, "AccountRequiresHttps"
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && errorCode == "" {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if errorCode != "" {
+			w.Header().Set("x-ms-error-code", errorCode)
+		}
+		w.WriteHeader(status)
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+
+	target := &Target{AccountName: "privateerdata"}
+	target.Endpoints.Blob = plain.URL
+	abs := &ABS{HTTPClient: plain.Client()}
+	result := abs.CCC_C01_TR01_T05(target)
+	if !result.Passed || strings.Count(result.Message, "rejected with AccountRequiresHttps (HTTP 400)") != 6 {
+		t.Errorf("plain HTTP refused with AccountRequiresHttps: passed=%t %s", result.Passed, result.Message)
+	}
+
+	status, errorCode = http.StatusNotFound, ""
+	result = abs.CCC_C01_TR01_T05(target)
+	if result.Passed || !strings.Contains(result.Message, "PUT was not rejected with AccountRequiresHttps (HTTP 201") {
+		t.Errorf("a 2xx over plain HTTP passed: %s", result.Message)
+	}
+
+	result = abs.CCC_C01_TR01_T04(target)
+	if result.Passed || !strings.Contains(result.Message, "List Containers was not served over TLS") {
+		t.Errorf("plain HTTP passed the TLS movement: %s", result.Message)
+	}
+
+	target.Endpoints.Blob = secure.URL
+	abs.HTTPClient = secure.Client()
+	result = abs.CCC_C01_TR01_T04(target)
+	if !result.Passed || !strings.Contains(result.Message, "OPTIONS used TLS 1.3 (HTTP 404)") {
+		t.Errorf("HTTPS probes failed: %s", result.Message)
+	}
+
+	status, errorCode = http.StatusBadRequest, "AccountRequiresHttps"
+	result = abs.CCC_C01_TR01_T04(target)
+	if result.Passed || !strings.Contains(result.Message, "rejected as insecure despite using HTTPS") {
+		t.Errorf("AccountRequiresHttps over HTTPS passed: %s", result.Message)
+	}
+}